@@ -0,0 +1,85 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MarshalCanonical returns the JSON encoding of the panel with object keys sorted
+// at every level, so that the output is stable across runs.
+func (p Panel) MarshalCanonical() ([]byte, error) {
+	return marshalCanonical(p)
+}
+
+// MarshalCanonical returns the JSON encoding of the dashboard with object keys sorted
+// at every level, so that the output is stable across runs.
+func (d Dashboard) MarshalCanonical() ([]byte, error) {
+	return marshalCanonical(d)
+}
+
+// MarshalIndent is like MarshalCanonical but indents the output with two spaces, as Grafana does.
+func (d Dashboard) MarshalIndent() ([]byte, error) {
+	raw, err := d.MarshalCanonical()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeDashboard reads a single JSON dashboard from r.
+func DecodeDashboard(r io.Reader) (Dashboard, error) {
+	var d Dashboard
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, fmt.Errorf("decode dashboard: %w", err)
+	}
+	return d, nil
+}
+
+// EncodeDashboard writes the canonical JSON encoding of the dashboard to w, followed by a newline.
+func EncodeDashboard(w io.Writer, d Dashboard) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return encodeCanonical(w, raw)
+}
+
+func marshalCanonical(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalize(raw)
+}
+
+// canonicalize returns the JSON value with sorted object keys and no insignificant whitespace.
+// Numbers are kept as written and HTML characters are not escaped.
+func canonicalize(raw json.RawMessage) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := encodeCanonical(&buf, raw); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// encodeCanonical writes the JSON value to w with sorted object keys, followed by a newline.
+func encodeCanonical(w io.Writer, raw json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshalCanonical(t *testing.T) {
+	t.Parallel()
+
+	p := Panel{
+		"type":    json.RawMessage(`"graph"`),
+		"targets": json.RawMessage(`[{"expr": "a > 1", "refId": "A", "datasource": {"uid": "x", "type": "prometheus"}}]`),
+		"id":      json.RawMessage(`12345678901234567890`),
+	}
+
+	got, err := p.MarshalCanonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":12345678901234567890,"targets":[{"datasource":{"type":"prometheus","uid":"x"},"expr":"a > 1","refId":"A"}],"type":"graph"}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeEncodeDashboard(t *testing.T) {
+	t.Parallel()
+
+	in := `{"title":"<Dash>","panels":[{"type":"graph","id":1}],"version":1.50}`
+	d, err := DecodeDashboard(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeDashboard(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"panels":[{"id":1,"type":"graph"}],"title":"<Dash>","version":1.50}` + "\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := DecodeDashboard(strings.NewReader(`[]`)); err == nil {
+		t.Fatal("expected error for non-object dashboard")
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"title":  json.RawMessage(`"Errors & <Latency>"`),
+		"panels": json.RawMessage(`[{"type":"graph","id":1,"targets":[]}]`),
+		"uid":    json.RawMessage(`"abc"`),
+	}
+
+	got, err := d.MarshalIndent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "panels": [
+    {
+      "id": 1,
+      "targets": [],
+      "type": "graph"
+    }
+  ],
+  "title": "Errors & <Latency>",
+  "uid": "abc"
+}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
@@ -37,7 +37,10 @@ func main() {
 		log.Fatal("reading dashboard ", err)
 	}
 
-	ps := d.Panels()
+	ps, err := d.PanelsE()
+	if err != nil {
+		log.Fatal("reading dashboard panels ", err)
+	}
 	for i := range *args.panels {
 		ps2, err := readFromFile[[]fusion.Panel]((*args.panels)[i])
 		if err != nil {
@@ -45,10 +48,16 @@ func main() {
 			if err2 != nil {
 				log.Fatal("reading panels ", err, err2)
 			}
-			ps2 = dd.Panels()
+			ps2, err = dd.PanelsE()
+			if err != nil {
+				log.Fatal("reading panels ", err)
+			}
 		}
 
-		ps = fusion.MergePanelsByGroup(ps, ps2, *args.top)
+		ps, err = fusion.MergePanelsByGroupE(ps, ps2, *args.top)
+		if err != nil {
+			log.Fatal("merging panels ", err)
+		}
 	}
 
 	d["panels"], err = json.Marshal(ps)
@@ -72,11 +81,12 @@ func main() {
 		out = os.Stdout
 	}
 
-	enc := json.NewEncoder(out)
-	enc.SetIndent("", "  ")
-	enc.SetEscapeHTML(false)
-	if err := enc.Encode(d); err != nil {
-		log.Println("encoding output dashboard ", err)
+	b, err := d.MarshalIndent()
+	if err != nil {
+		log.Fatal("encoding output dashboard ", err)
+	}
+	if _, err := out.Write(append(b, '\n')); err != nil {
+		log.Println("writing output dashboard ", err)
 	}
 }
 
@@ -0,0 +1,154 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import "fmt"
+
+// Conflict describes two competing versions of the same panel.
+// One of the versions is nil if the panel was removed on that side.
+type Conflict struct {
+	// Key identifies the panel by what it was matched on,
+	// its type and title by default or its id with WithMatchByID.
+	Key string
+	// Current is the existing version of the panel.
+	Current Panel
+	// Incoming is the competing version of the panel.
+	Incoming Panel
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("conflict on panel %s", c.Key)
+}
+
+// MergePanelsWithConflicts is like MergePanels but also returns a Conflict
+// for every panel in ps1 that was overwritten by a matching panel in ps2,
+// including the panels overwritten with the same content. The conflicts do not affect the merge.
+func MergePanelsWithConflicts(ps1, ps2 []Panel, opts ...Option) ([]Panel, []Conflict) {
+	key := newOptions(opts).matchName
+	var conflicts []Conflict
+	opts = append(opts[:len(opts):len(opts)], withOnMatch(func(old, new Panel) {
+		conflicts = append(conflicts, Conflict{Key: key(new), Current: old, Incoming: new.Clone()})
+	}))
+	return MergePanels(ps1, ps2, opts...), conflicts
+}
+
+// panelKey returns a human readable key identifying the panel by its type and title.
+func panelKey(p Panel) string {
+	t, _ := p.Type()
+	title, _ := p.Title()
+	return fmt.Sprintf("%s %q", t, title)
+}
+
+// MergePanels3 is like MergePanels3E but panics on error.
+func MergePanels3(base, local, upstream []Panel, opts ...Option) ([]Panel, []Conflict) {
+	res, conflicts, err := MergePanels3E(base, local, upstream, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return res, conflicts
+}
+
+// MergePanels3E performs a three-way merge of local and upstream,
+// which are both derived from base.
+//
+// Changes made on only one side are applied: panels added upstream are appended
+// as in MergePanels, panels changed upstream overwrite the local panel while
+// preserving its position and id, and panels removed upstream are removed if
+// they were not changed locally.
+// When both sides changed the same panel differently the local version is kept
+// and a Conflict is reported.
+//
+// Panels are matched and merged as in MergePanels, including WithMatchWithinRow.
+// It returns a *MergeError if a field of a panel cannot be unmarshalled.
+func MergePanels3E(base, local, upstream []Panel, opts ...Option) ([]Panel, []Conflict, error) {
+	o := newOptions(opts)
+
+	res := make([]Panel, 0, len(local)+len(upstream))
+	for _, p := range local {
+		res = append(res, p.Clone())
+	}
+	removed := make([]bool, len(res))
+
+	// the row group of every panel, only panels in the same group match
+	groupsBase := make([]string, len(base))
+	groupsLocal := make([]string, len(res))
+	groupsUpstream := make([]string, len(upstream))
+	if o.matchWithinRow {
+		groupsBase, groupsLocal, groupsUpstream = rowGroups(base), rowGroups(res), rowGroups(upstream)
+	}
+	baseIdx := newMatchIndex(base, groupsBase, o)
+	localIdx := newMatchIndex(res, groupsLocal, o)
+
+	var (
+		added     []Panel
+		conflicts []Conflict
+	)
+	usedBase := make([]bool, len(base))
+	usedLocal := make([]bool, len(res))
+	for i, u := range upstream {
+		b := baseIdx.findUnused(base, u, groupsUpstream[i], usedBase)
+		l := localIdx.findUnused(res, u, groupsUpstream[i], usedLocal)
+
+		switch {
+		case b < 0 && l < 0:
+			// added upstream
+			added = append(added, u)
+		case b < 0:
+			// added on both sides
+			usedLocal[l] = true
+			if !contentEqual(res[l], u) {
+				conflicts = append(conflicts, Conflict{Key: o.matchName(u), Current: res[l], Incoming: u})
+			}
+		case l < 0:
+			// removed locally
+			usedBase[b] = true
+			if !contentEqual(base[b], u) {
+				conflicts = append(conflicts, Conflict{Key: o.matchName(u), Incoming: u})
+			}
+		default:
+			usedBase[b], usedLocal[l] = true, true
+			localChanged := !contentEqual(base[b], res[l])
+			upstreamChanged := !contentEqual(base[b], u)
+			switch {
+			case upstreamChanged && !localChanged:
+				merged, err := mergeMatched(res[l], u.Clone(), o)
+				if err != nil {
+					return nil, nil, err
+				}
+				res[l] = merged
+			case upstreamChanged && !contentEqual(res[l], u):
+				conflicts = append(conflicts, Conflict{Key: o.matchName(u), Current: res[l], Incoming: u})
+			}
+		}
+	}
+
+	// panels removed upstream
+	for i, b := range base {
+		if usedBase[i] {
+			continue
+		}
+		l := localIdx.findUnused(res, b, groupsBase[i], usedLocal)
+		if l < 0 {
+			continue
+		}
+		usedLocal[l] = true
+		if contentEqual(b, res[l]) {
+			removed[l] = true
+		} else {
+			conflicts = append(conflicts, Conflict{Key: o.matchName(b), Current: res[l]})
+		}
+	}
+
+	kept := res[:0]
+	for i, p := range res {
+		if !removed[i] {
+			kept = append(kept, p)
+		}
+	}
+
+	merged, err := MergePanelsE(kept, added, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
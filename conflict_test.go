@@ -0,0 +1,186 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergePanels3(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, content string, y int) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"graph"`),
+			"content": json.RawMessage(`"` + content + `"`),
+			"gridPos": json.RawMessage(fmt.Sprintf(`{"h":2,"w":6,"x":0,"y":%d}`, y)),
+		}
+	}
+
+	base := []Panel{
+		panel("Unchanged", "base", 0),
+		panel("Local", "base", 2),
+		panel("Upstream", "base", 4),
+		panel("Both", "base", 6),
+		panel("Removed", "base", 8),
+	}
+	local := []Panel{
+		panel("Unchanged", "base", 0),
+		panel("Local", "local", 2),
+		panel("Upstream", "base", 4),
+		panel("Both", "local", 6),
+		panel("Removed", "base", 8),
+	}
+	upstream := []Panel{
+		panel("Unchanged", "base", 1),
+		panel("Local", "base", 3),
+		panel("Upstream", "upstream", 5),
+		panel("Both", "upstream", 7),
+	}
+
+	merged, conflicts := MergePanels3(base, local, upstream, WithPreserveIDs(true))
+
+	var got []string
+	for _, p := range merged {
+		title, _ := p.Title()
+		var content string
+		_ = json.Unmarshal(p["content"], &content)
+		got = append(got, title+":"+content)
+	}
+	want := []string{"Unchanged:base", "Local:local", "Upstream:upstream", "Both:local"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected panels (-want +got):\n%s", diff)
+	}
+	if gp := merged[2].GridPos(); gp.Y != 4 {
+		t.Errorf("expected upstream change to keep the local position, got Y %d", gp.Y)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Key != `graph "Both"` {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+}
+
+func TestMergePanelsWithConflicts(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Same"`), "type": json.RawMessage(`"graph"`), "content": json.RawMessage(`"a"`)},
+		{"title": json.RawMessage(`"Changed"`), "type": json.RawMessage(`"graph"`), "content": json.RawMessage(`"a"`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Same"`), "type": json.RawMessage(`"graph"`), "content": json.RawMessage(`"a"`)},
+		{"title": json.RawMessage(`"Changed"`), "type": json.RawMessage(`"graph"`), "content": json.RawMessage(`"b"`)},
+	}
+
+	_, conflicts := MergePanelsWithConflicts(base, extra)
+	want := []Conflict{
+		{Key: `graph "Same"`, Current: base[0], Incoming: extra[0]},
+		{Key: `graph "Changed"`, Current: base[1], Incoming: extra[1]},
+	}
+	if diff := cmp.Diff(want, conflicts); diff != "" {
+		t.Fatalf("unexpected conflicts (-want +got):\n%s", diff)
+	}
+
+	base[1]["id"] = json.RawMessage(`3`)
+	renamed := Panel{"title": json.RawMessage(`"Renamed"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`3`)}
+	_, conflicts = MergePanelsWithConflicts(base, []Panel{renamed}, WithMatchByID())
+	want = []Conflict{{Key: "id 3", Current: base[1], Incoming: renamed}}
+	if diff := cmp.Diff(want, conflicts); diff != "" {
+		t.Fatalf("unexpected conflicts (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanels3Options(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, content string, id int) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"graph"`),
+			"content": json.RawMessage(`"` + content + `"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"id":      json.RawMessage(fmt.Sprint(id)),
+		}
+	}
+	row := func(title string, id int) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"row"`),
+			"gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`),
+			"id":      json.RawMessage(fmt.Sprint(id)),
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		base, local, upstream []Panel
+		opts                  []Option
+		wanted                []string
+	}{
+		{
+			name:     "match across rows",
+			base:     []Panel{row("A", 1), panel("CPU", "base", 2), row("B", 3), panel("CPU", "base", 4)},
+			local:    []Panel{row("A", 1), panel("CPU", "base", 2), row("B", 3), panel("CPU", "base", 4)},
+			upstream: []Panel{row("A", 1), row("B", 3), panel("CPU", "upstream", 4)},
+			wanted:   []string{"A:", "CPU:upstream", "B:"},
+		},
+		{
+			name:     "match within row",
+			base:     []Panel{row("A", 1), panel("CPU", "base", 2), row("B", 3), panel("CPU", "base", 4)},
+			local:    []Panel{row("A", 1), panel("CPU", "base", 2), row("B", 3), panel("CPU", "base", 4)},
+			upstream: []Panel{row("A", 1), row("B", 3), panel("CPU", "upstream", 4)},
+			opts:     []Option{WithMatchWithinRow()},
+			wanted:   []string{"A:", "B:", "CPU:upstream"},
+		},
+		{
+			name:     "match by id",
+			base:     []Panel{panel("CPU", "base", 1)},
+			local:    []Panel{panel("CPU", "base", 1)},
+			upstream: []Panel{panel("CPU usage", "upstream", 1)},
+			opts:     []Option{WithMatchByID()},
+			wanted:   []string{"CPU usage:upstream"},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			merged, conflicts, err := MergePanels3E(tc.base, tc.local, tc.upstream, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range merged {
+				title, _ := p.Title()
+				var content string
+				_ = json.Unmarshal(p["content"], &content)
+				got = append(got, title+":"+content)
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Errorf("unexpected panels (-want +got):\n%s", diff)
+			}
+			if len(conflicts) != 0 {
+				t.Errorf("unexpected conflicts %v", conflicts)
+			}
+		})
+	}
+}
+
+func TestMergePanels3Error(t *testing.T) {
+	t.Parallel()
+
+	local := []Panel{{"title": json.RawMessage(`"Bad"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`"oops"`)}}
+	upstream := []Panel{{"title": json.RawMessage(`"New"`), "type": json.RawMessage(`"graph"`)}}
+
+	var me *MergeError
+	if _, _, err := MergePanels3E(nil, local, upstream); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
@@ -0,0 +1,591 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// MergeDashboards merges the panels of d2 into the panels of d1 by group,
+// see MergePanelsByGroup.
+//
+// The result is a new dashboard where the top-level fields are combined as follows:
+//   - templating and annotations contain the entries of d1 followed by the entries
+//     of d2 with a different name, see MergeTemplating and MergeAnnotations;
+//   - links contain the links of d1 followed by the links of d2 with a different title or url;
+//   - tags are the union of the tags of both dashboards, see MergeTags;
+//   - time, timezone and refresh are taken from d1 by default, see WithTimeSettings;
+//   - all the other fields, including the ones this package does not know about,
+//     are copied from d1 as they are, the other fields of d2 are ignored.
+//
+// Neither d1 nor d2 are modified.
+func MergeDashboards(d1, d2 Dashboard, opts ...Option) (Dashboard, error) {
+	o := newOptions(opts)
+
+	if o.migrate != nil {
+		var err error
+		if d1, err = o.migrate(d1.Clone()); err != nil {
+			return nil, fmt.Errorf("migrate base dashboard: %w", err)
+		}
+		if d2, err = o.migrate(d2.Clone()); err != nil {
+			return nil, fmt.Errorf("migrate merged dashboard: %w", err)
+		}
+	}
+
+	ps1, err := d1.PanelsE()
+	if err != nil {
+		return nil, fmt.Errorf("base dashboard: %w", err)
+	}
+	ps2, err := d2.PanelsE()
+	if err != nil {
+		return nil, fmt.Errorf("merged dashboard: %w", err)
+	}
+
+	res := d1.Clone()
+	if res == nil {
+		res = make(Dashboard)
+	}
+
+	ps, err := MergePanelsByGroupE(ps1, ps2, false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res["panels"], err = json.Marshal(ps)
+	if err != nil {
+		return nil, fmt.Errorf("marshal panels: %w", err)
+	}
+
+	templating, err := MergeTemplating(d1, d2)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.setList("templating", templating); err != nil {
+		return nil, err
+	}
+
+	annotations, err := MergeAnnotations(d1, d2)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.setList("annotations", annotations); err != nil {
+		return nil, err
+	}
+
+	l1, err := d1.Links()
+	if err != nil {
+		return nil, err
+	}
+	l2, err := d2.Links()
+	if err != nil {
+		return nil, err
+	}
+	if links := unionLinks(l1, l2); len(links) > 0 {
+		if err := setField(res, "links", links); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, k := range timeSettingsFields {
+		v2, ok := d2[k]
+		if !ok {
+			continue
+		}
+		_, inBase := res[k]
+		switch o.timeSettings {
+		case TimeSettingsFromMerged:
+			res[k] = bytes.Clone(v2)
+		case TimeSettingsFillMissing:
+			if !inBase {
+				res[k] = bytes.Clone(v2)
+			}
+		}
+	}
+
+	tags, err := MergeTags(d1, d2)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		if res["tags"], err = json.Marshal(tags); err != nil {
+			return nil, fmt.Errorf("marshal tags: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// Title returns the dashboard title and whether it is present.
+func (d Dashboard) Title() (string, bool) {
+	return stringField(d, "title")
+}
+
+// SetTitle sets the dashboard title.
+func (d Dashboard) SetTitle(title string) error {
+	return setField(d, "title", title)
+}
+
+// UID returns the dashboard uid and whether it is present.
+func (d Dashboard) UID() (string, bool) {
+	return stringField(d, "uid")
+}
+
+// SetUID sets the dashboard uid.
+func (d Dashboard) SetUID(uid string) error {
+	return setField(d, "uid", uid)
+}
+
+// SchemaVersion returns the dashboard schemaVersion and whether it is present.
+func (d Dashboard) SchemaVersion() (int, bool) {
+	return intField(d, "schemaVersion")
+}
+
+// TimeRange is the default time range of a dashboard, e.g. "now-6h" to "now".
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Time returns the dashboard default time range and whether it is present and valid.
+func (d Dashboard) Time() (TimeRange, bool) {
+	raw, ok := d["time"]
+	if !ok {
+		return TimeRange{}, false
+	}
+	var tr TimeRange
+	if err := json.Unmarshal(raw, &tr); err != nil {
+		return TimeRange{}, false
+	}
+	return tr, true
+}
+
+// Timezone returns the dashboard timezone and whether it is present, e.g. "browser" or "utc".
+func (d Dashboard) Timezone() (string, bool) {
+	return stringField(d, "timezone")
+}
+
+// Refresh returns the dashboard auto-refresh interval and whether it is set, e.g. "30s".
+// Auto-refresh is disabled when it is not set.
+func (d Dashboard) Refresh() (string, bool) {
+	r, ok := stringField(d, "refresh")
+	return r, ok && r != ""
+}
+
+// Tags returns the dashboard tags.
+// A missing tags field is reported as an empty slice.
+func (d Dashboard) Tags() ([]string, error) {
+	raw, ok := d["tags"]
+	if !ok {
+		return []string{}, nil
+	}
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		return nil, fmt.Errorf("unmarshal tags: %w", err)
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags, nil
+}
+
+// MergeTags returns the sorted and deduplicated union of the tags of d1 and d2.
+func MergeTags(d1, d2 Dashboard) ([]string, error) {
+	t1, err := d1.Tags()
+	if err != nil {
+		return nil, err
+	}
+	t2, err := d2.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := append(slices.Clone(t1), t2...)
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
+
+// MergeTemplating returns the union of the template variables in templating.list of d1 and d2.
+// Variables are matched by name, on conflict the variable from d1 is kept.
+// Variables that exist only in d2 are appended.
+func MergeTemplating(d1, d2 Dashboard) ([]json.RawMessage, error) {
+	return mergeListsByName(d1, d2, "templating")
+}
+
+// MergeAnnotations returns the union of the annotation queries in annotations.list of d1 and d2.
+// Annotations are matched by name, on conflict the annotation from d1 is kept,
+// so the built-in "Annotations & Alerts" entry appears only once.
+func MergeAnnotations(d1, d2 Dashboard) ([]json.RawMessage, error) {
+	return mergeListsByName(d1, d2, "annotations")
+}
+
+func mergeListsByName(d1, d2 Dashboard, field string) ([]json.RawMessage, error) {
+	l1, err := d1.list(field)
+	if err != nil {
+		return nil, err
+	}
+	l2, err := d2.list(field)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(l1)+len(l2))
+	res := make([]json.RawMessage, 0, len(l1)+len(l2))
+	for _, l := range [][]json.RawMessage{l1, l2} {
+		for _, e := range l {
+			name, ok := listEntryName(e)
+			if ok && seen[name] {
+				continue
+			}
+			if ok {
+				seen[name] = true
+			}
+			res = append(res, e)
+		}
+	}
+
+	return res, nil
+}
+
+func listEntryName(e json.RawMessage) (string, bool) {
+	var v struct {
+		Name *string `json:"name"`
+	}
+	if err := json.Unmarshal(e, &v); err != nil || v.Name == nil {
+		return "", false
+	}
+	return *v.Name, true
+}
+
+// list returns the elements of the list field of the object stored under field,
+// e.g. templating.list.
+func (d Dashboard) list(field string) ([]json.RawMessage, error) {
+	raw, ok := d[field]
+	if !ok {
+		return nil, nil
+	}
+	var v struct {
+		List []json.RawMessage `json:"list"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", field, err)
+	}
+	return v.List, nil
+}
+
+// setList sets the list field of the object stored under field,
+// preserving the other fields of the object.
+// It does nothing if list is empty and the field is not present.
+func (d Dashboard) setList(field string, list []json.RawMessage) error {
+	raw, ok := d[field]
+	if !ok && len(list) == 0 {
+		return nil
+	}
+
+	obj := make(map[string]json.RawMessage)
+	if ok {
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return fmt.Errorf("unmarshal %s: %w", field, err)
+		}
+	}
+
+	if list == nil {
+		list = []json.RawMessage{}
+	}
+	listRaw, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("marshal %s.list: %w", field, err)
+	}
+	obj["list"] = listRaw
+
+	if raw, err = json.Marshal(obj); err != nil {
+		return fmt.Errorf("marshal %s: %w", field, err)
+	}
+	d[field] = raw
+	return nil
+}
+
+// AllPanels is like AllPanelsE but panics on error.
+func (d Dashboard) AllPanels() []Panel {
+	ps, err := d.AllPanelsE()
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// AllPanelsE returns all panels of the dashboard, including panels nested in rows.
+// Every row is followed by the panels it contains, so the parent row of a panel
+// is the closest row preceding it.
+func (d Dashboard) AllPanelsE() ([]Panel, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, err
+	}
+	return flattenPanels(ps)
+}
+
+// PanelWithRow is a panel along with the title of the row it belongs to.
+type PanelWithRow struct {
+	Panel Panel
+	// Row is the title of the row the panel belongs to, empty for panels
+	// that do not belong to any row and for rows themselves.
+	Row string
+}
+
+// AllPanelsWithRow is like AllPanelsWithRowE but panics on error.
+func (d Dashboard) AllPanelsWithRow() []PanelWithRow {
+	ps, err := d.AllPanelsWithRowE()
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// AllPanelsWithRowE is like AllPanelsE but also returns the title of the row every panel belongs to.
+// Panels belong to the row they are embedded in, if the row is collapsed,
+// or to the closest row preceding them, if it is not.
+func (d Dashboard) AllPanelsWithRowE() ([]PanelWithRow, error) {
+	all, err := d.AllPanelsE()
+	if err != nil {
+		return nil, err
+	}
+	// in AllPanels every row is followed by its embedded panels and then by the panels
+	// following it, so the row of a panel is always the closest row preceding it
+	var res []PanelWithRow
+	var row string
+	for _, p := range all {
+		if p.isRow() {
+			row, _ = p.Title()
+			res = append(res, PanelWithRow{Panel: p})
+			continue
+		}
+		res = append(res, PanelWithRow{Panel: p, Row: row})
+	}
+	return res, nil
+}
+
+// PanelTypeCounts returns the number of panels of each type, including panels nested in rows.
+// Rows are counted under "row" and panels without a type under "".
+func (d Dashboard) PanelTypeCounts() (map[string]int, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, err
+	}
+	all, err := flattenPanels(ps)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, p := range all {
+		t, _ := p.Type()
+		counts[t]++
+	}
+	return counts, nil
+}
+
+// PanelsOfType is like PanelsOfTypeE but panics on error.
+func (d Dashboard) PanelsOfType(t string) []Panel {
+	ps, err := d.PanelsOfTypeE(t)
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// PanelsOfTypeE returns all panels of the given type, including panels nested in rows.
+func (d Dashboard) PanelsOfTypeE(t string) ([]Panel, error) {
+	all, err := d.AllPanelsE()
+	if err != nil {
+		return nil, err
+	}
+	var res []Panel
+	for _, p := range all {
+		if pt, ok := p.Type(); ok && pt == t {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// MigratePanelType returns a copy of the dashboard where every panel of type from,
+// including panels nested in rows, is passed to transform and then given type to.
+// transform receives a copy of the panel and may be nil, returning nil removes the panel.
+func MigratePanelType(d Dashboard, from, to string, transform func(Panel) Panel) (Dashboard, error) {
+	return d.TransformPanels(func(p Panel) (Panel, error) {
+		if t, ok := p.Type(); !ok || t != from {
+			return p, nil
+		}
+		if transform != nil {
+			if p = transform(p); p == nil {
+				return nil, nil
+			}
+		}
+		if err := p.SetType(to); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+}
+
+// FindPanel is like FindPanelE but reports malformed panels as not found.
+func (d Dashboard) FindPanel(title string) (Panel, bool) {
+	p, ok, err := d.FindPanelE(title)
+	if err != nil {
+		return nil, false
+	}
+	return p, ok
+}
+
+// FindPanelE returns the first panel with the given title, including panels nested in rows.
+// It returns an error if the panels cannot be unmarshalled.
+func (d Dashboard) FindPanelE(title string) (Panel, bool, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, false, err
+	}
+	all, err := flattenPanels(ps)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, p := range all {
+		if t, ok := p.Title(); ok && t == title {
+			return p, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// WalkPanels calls fn for every panel of the dashboard, including the panels nested in rows,
+// in document order, each row before its panels. It stops at the first error and returns it.
+// Changes made by fn to the panels are not saved in the dashboard, see TransformPanels.
+func (d Dashboard) WalkPanels(fn func(p Panel) error) error {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return err
+	}
+	all, err := flattenPanels(ps)
+	if err != nil {
+		return err
+	}
+	for _, p := range all {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransformPanels returns a copy of the dashboard where every panel, including
+// the panels nested in rows, is replaced by the result of fn.
+// fn is called with a copy of the panel, nested panels are transformed before their parent.
+// Panels for which fn returns nil are removed, the first error stops the transformation.
+func (d Dashboard) TransformPanels(fn func(Panel) (Panel, error)) (Dashboard, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, err
+	}
+	ps, err = transformPanels(ps, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	res := d.Clone()
+	if res == nil {
+		res = make(Dashboard)
+	}
+	if ps != nil {
+		if err := setField(res, "panels", ps); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func transformPanels(ps []Panel, fn func(Panel) (Panel, error)) ([]Panel, error) {
+	res := make([]Panel, 0, len(ps))
+	for _, p := range ps {
+		p = p.Clone()
+
+		if raw := p.PanelsRaw(); raw != nil {
+			var nested []Panel
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return nil, newMergeError(p, "panels", fmt.Errorf("unmarshal panels: %w", err))
+			}
+			nested, err := transformPanels(nested, fn)
+			if err != nil {
+				return nil, err
+			}
+			if err := setField(p, "panels", nested); err != nil {
+				return nil, err
+			}
+		}
+
+		p, err := fn(p)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// SetAllRowsCollapsed returns a copy of the dashboard with all the rows collapsed or expanded.
+// Collapsing a row moves the panels following it, up to the next row, into the row's panels field,
+// expanding a row moves its embedded panels right after it, as Grafana expects.
+func (d Dashboard) SetAllRowsCollapsed(collapsed bool) (Dashboard, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, err
+	}
+
+	flat := liftEmbeddedPanels(ps)
+	for i, p := range flat {
+		if !p.isRow() {
+			continue
+		}
+		p = p.Clone()
+		if err := p.SetCollapsed(collapsed); err != nil {
+			return nil, err
+		}
+		if err := p.setField("panels", []Panel{}); err != nil {
+			return nil, err
+		}
+		flat[i] = p
+	}
+
+	res := d.Clone()
+	if res == nil {
+		res = make(Dashboard)
+	}
+	nested, err := renestCollapsedRows(flat)
+	if err != nil {
+		return nil, err
+	}
+	if err := setField(res, "panels", nested); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SetPanels returns a copy of the dashboard with the panels field set to ps.
+// The panels following a collapsed row, up to the next row, are moved into the row's panels field,
+// so that the flat panels returned by MergePanelsByGroup can be set back without breaking collapsed rows.
+// The input panels are not modified.
+func (d Dashboard) SetPanels(ps []Panel) (Dashboard, error) {
+	res := d.Clone()
+	if res == nil {
+		res = make(Dashboard)
+	}
+	nested, err := renestCollapsedRows(ps)
+	if err != nil {
+		return nil, err
+	}
+	if err := setField(res, "panels", nested); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
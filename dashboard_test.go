@@ -0,0 +1,905 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeDashboards(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"title":  json.RawMessage(`"Base"`),
+		"panels": json.RawMessage(`[{"title":"Panel1","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":0},"id":1}]`),
+	}
+	d2 := Dashboard{
+		"title":  json.RawMessage(`"Extra"`),
+		"panels": json.RawMessage(`[{"title":"Panel1","type":"graph","content":"new","id":7}]`),
+	}
+	d1Panels, d2Panels := string(d1["panels"]), string(d2["panels"])
+
+	merged, err := MergeDashboards(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(`"Base"`, string(merged["title"])); diff != "" {
+		t.Errorf("unexpected title (-want +got):\n%s", diff)
+	}
+	wanted := []Panel{
+		{
+			"title":   json.RawMessage(`"Panel1"`),
+			"type":    json.RawMessage(`"graph"`),
+			"content": json.RawMessage(`"new"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"id":      json.RawMessage(`1`),
+		},
+	}
+	if diff := cmp.Diff(wanted, merged.Panels()); diff != "" {
+		t.Errorf("unexpected panels (-want +got):\n%s", diff)
+	}
+
+	if string(d1["panels"]) != d1Panels || string(d2["panels"]) != d2Panels {
+		t.Error("inputs were modified")
+	}
+}
+
+func TestParseDashboard(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{name: "valid", data: `{"title":"A","panels":[{"type":"graph"}]}`},
+		{name: "no panels", data: `{"title":"A"}`},
+		{name: "array", data: `[]`, err: "dashboard is not an object, got array"},
+		{name: "null", data: `null`, err: "dashboard is not an object, got null"},
+		{name: "panels object", data: `{"panels":{"panels":[]}}`, err: "panels field is not an array, got object"},
+		{name: "panels number", data: `{"panels":1}`, err: "panels field is not an array, got number"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d, err := ParseDashboard([]byte(tc.data))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.PanelsE(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPanelsENotArray(t *testing.T) {
+	t.Parallel()
+
+	for _, raw := range []string{`{"panels":[]}`, `42`, `"panels"`} {
+		_, err := Dashboard{"panels": json.RawMessage(raw)}.PanelsE()
+		if err == nil || !strings.HasPrefix(err.Error(), "panels field is not an array, got ") {
+			t.Fatalf("%s: unexpected error %v", raw, err)
+		}
+	}
+
+	ps, err := Dashboard{"panels": json.RawMessage(`null`)}.PanelsE()
+	if err != nil || len(ps) != 0 {
+		t.Fatalf("expected no panels for null, got %v, %v", ps, err)
+	}
+}
+
+func TestMergeDashboardsUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"graphTooltip": json.RawMessage(`1`),
+		"weekStart":    json.RawMessage(`"monday"`),
+		"x-custom":     json.RawMessage(`{"owner": "team-a", "n": [1, 2.50]}`),
+	}
+	d2 := Dashboard{
+		"graphTooltip": json.RawMessage(`0`),
+		"liveNow":      json.RawMessage(`true`),
+	}
+
+	merged, err := MergeDashboards(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range d1 {
+		if diff := cmp.Diff(string(v), string(merged[k])); diff != "" {
+			t.Errorf("%s: unexpected result (-want +got):\n%s", k, diff)
+		}
+	}
+	if _, ok := merged["liveNow"]; ok {
+		t.Error("expected fields only in d2 not to be copied")
+	}
+}
+
+func TestMergeDashboardsTimeSettings(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"time":     json.RawMessage(`{"from":"now-6h","to":"now"}`),
+		"timezone": json.RawMessage(`"utc"`),
+	}
+	d2 := Dashboard{
+		"time":     json.RawMessage(`{"from":"now-1h","to":"now"}`),
+		"timezone": json.RawMessage(`"browser"`),
+		"refresh":  json.RawMessage(`"30s"`),
+	}
+
+	type settings struct {
+		Time     TimeRange
+		Timezone string
+		Refresh  string
+	}
+	tests := []struct {
+		name   string
+		ts     TimeSettings
+		wanted settings
+	}{
+		{
+			name:   "from base",
+			ts:     TimeSettingsFromBase,
+			wanted: settings{TimeRange{"now-6h", "now"}, "utc", ""},
+		},
+		{
+			name:   "from merged",
+			ts:     TimeSettingsFromMerged,
+			wanted: settings{TimeRange{"now-1h", "now"}, "browser", "30s"},
+		},
+		{
+			name:   "fill missing",
+			ts:     TimeSettingsFillMissing,
+			wanted: settings{TimeRange{"now-6h", "now"}, "utc", "30s"},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d, err := MergeDashboards(d1, d2, WithTimeSettings(tc.ts))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got settings
+			got.Time, _ = d.Time()
+			got.Timezone, _ = d.Timezone()
+			got.Refresh, _ = d.Refresh()
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDashboardTitleUID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		d        Dashboard
+		title    string
+		hasTitle bool
+		uid      string
+		hasUID   bool
+	}{
+		{name: "absent"},
+		{
+			name:     "present",
+			d:        Dashboard{"title": json.RawMessage(`"Overview"`), "uid": json.RawMessage(`"abc-123"`)},
+			title:    "Overview",
+			hasTitle: true,
+			uid:      "abc-123",
+			hasUID:   true,
+		},
+		{name: "null", d: Dashboard{"title": json.RawMessage(`null`), "uid": json.RawMessage(`null`)}},
+		{name: "not a string", d: Dashboard{"title": json.RawMessage(`1`), "uid": json.RawMessage(`{}`)}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if title, ok := tc.d.Title(); title != tc.title || ok != tc.hasTitle {
+				t.Fatalf("unexpected title %q, %v", title, ok)
+			}
+			if uid, ok := tc.d.UID(); uid != tc.uid || ok != tc.hasUID {
+				t.Fatalf("unexpected uid %q, %v", uid, ok)
+			}
+
+			d := tc.d.Clone()
+			if d == nil {
+				d = make(Dashboard)
+			}
+			if err := d.SetTitle("New"); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.SetUID("new-uid"); err != nil {
+				t.Fatal(err)
+			}
+			if title, ok := d.Title(); title != "New" || !ok {
+				t.Fatalf("unexpected title after SetTitle %q, %v", title, ok)
+			}
+			if uid, ok := d.UID(); uid != "new-uid" || !ok {
+				t.Fatalf("unexpected uid after SetUID %q, %v", uid, ok)
+			}
+		})
+	}
+}
+
+func TestMergeDashboardsMigration(t *testing.T) {
+	t.Parallel()
+
+	errUnsupported := errors.New("unsupported schema version")
+	migrate := func(d Dashboard) (Dashboard, error) {
+		if v, ok := d.SchemaVersion(); !ok || v < 30 {
+			return nil, errUnsupported
+		}
+		// Modify the dashboard in place, MergeDashboards must pass a copy.
+		d["schemaVersion"] = json.RawMessage(`39`)
+		return MigratePanelType(d, "graph", "timeseries", nil)
+	}
+
+	dashboard := func(version, title string) Dashboard {
+		d := Dashboard{
+			"panels": json.RawMessage(`[{"title":"` + title + `","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":0},"id":1}]`),
+		}
+		if version != "" {
+			d["schemaVersion"] = json.RawMessage(version)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		d1, d2  Dashboard
+		wantErr string
+	}{
+		{
+			name: "migrate both",
+			d1:   dashboard(`36`, "A"),
+			d2:   dashboard(`36`, "B"),
+		},
+		{
+			name:    "base error",
+			d1:      dashboard(`16`, "A"),
+			d2:      dashboard(`36`, "B"),
+			wantErr: "migrate base dashboard: unsupported schema version",
+		},
+		{
+			name:    "merged error",
+			d1:      dashboard(`36`, "A"),
+			d2:      dashboard(`"36"`, "B"),
+			wantErr: "migrate merged dashboard: unsupported schema version",
+		},
+		{
+			name:    "missing schema version",
+			d1:      dashboard(`36`, "A"),
+			d2:      dashboard(``, "B"),
+			wantErr: "migrate merged dashboard: unsupported schema version",
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			d1, d2 := tc.d1.Clone(), tc.d2.Clone()
+			merged, err := MergeDashboards(tc.d1, tc.d2, WithMigration(migrate))
+			if diff := cmp.Diff(d1, tc.d1); diff != "" {
+				t.Errorf("base dashboard was modified (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(d2, tc.d2); diff != "" {
+				t.Errorf("merged dashboard was modified (-want +got):\n%s", diff)
+			}
+
+			if tc.wantErr != "" {
+				if err == nil || !errors.Is(err, errUnsupported) || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q wrapping errUnsupported, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v, ok := merged.SchemaVersion(); !ok || v != 39 {
+				t.Errorf("unexpected schemaVersion: %d, %t", v, ok)
+			}
+			var types []string
+			for _, p := range merged.Panels() {
+				typ, _ := p.Type()
+				types = append(types, typ)
+			}
+			if diff := cmp.Diff([]string{"timeseries", "timeseries"}, types); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDashboardClone(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"title":  json.RawMessage(`"Base"`),
+		"panels": json.RawMessage(`[{"title":"Panel1"}]`),
+	}
+	c := d.Clone()
+	if diff := cmp.Diff(d, c); diff != "" {
+		t.Fatalf("unexpected clone (-want +got):\n%s", diff)
+	}
+
+	c["title"][1] = 'X'
+	c["uid"] = json.RawMessage(`"abc"`)
+	if diff := cmp.Diff(`"Base"`, string(d["title"])); diff != "" {
+		t.Errorf("original modified through the clone (-want +got):\n%s", diff)
+	}
+	if _, ok := d["uid"]; ok {
+		t.Error("expected fields added to the clone not to be added to the original")
+	}
+
+	if Dashboard(nil).Clone() != nil {
+		t.Error("expected the clone of a nil dashboard to be nil")
+	}
+}
+
+func TestMergeDashboardsAnnotations(t *testing.T) {
+	t.Parallel()
+
+	const builtin = `{"builtIn":1,"datasource":"-- Grafana --","enable":true,"name":"Annotations & Alerts"}`
+	d1 := Dashboard{
+		"annotations": json.RawMessage(`{"list":[` + builtin + `,{"name":"Deploys","expr":"deploys"}]}`),
+	}
+	d2 := Dashboard{
+		"annotations": json.RawMessage(`{"list":[` + builtin + `,{"name":"Deploys","expr":"other"},{"name":"Incidents"}]}`),
+	}
+
+	merged, err := MergeDashboards(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got, want any
+	if err := json.Unmarshal(merged["annotations"], &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"list":[`+builtin+`,{"name":"Deploys","expr":"deploys"},{"name":"Incidents"}]}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected annotations (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		d1, d2 Dashboard
+		wanted []string
+		err    bool
+	}{
+		{
+			name:   "union",
+			d1:     Dashboard{"tags": json.RawMessage(`["team-b","prod"]`)},
+			d2:     Dashboard{"tags": json.RawMessage(`["team-a","prod","prod"]`)},
+			wanted: []string{"prod", "team-a", "team-b"},
+		},
+		{
+			name:   "missing tags",
+			d1:     Dashboard{},
+			d2:     Dashboard{"tags": json.RawMessage(`["b","a"]`)},
+			wanted: []string{"a", "b"},
+		},
+		{
+			name:   "no tags",
+			d1:     Dashboard{"tags": json.RawMessage(`null`)},
+			d2:     Dashboard{},
+			wanted: []string{},
+		},
+		{
+			name: "malformed",
+			d1:   Dashboard{"tags": json.RawMessage(`"prod"`)},
+			d2:   Dashboard{},
+			err:  true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tags, err := MergeTags(tc.d1, tc.d2)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wanted, tags); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeTemplating(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"templating": json.RawMessage(`{"list":[{"name":"datasource","type":"datasource"},{"name":"job","query":"a"}]}`),
+	}
+	d2 := Dashboard{
+		"templating": json.RawMessage(`{"list":[{"name":"job","query":"b"},{"name":"instance"}]}`),
+	}
+
+	list, err := MergeTemplating(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := []json.RawMessage{
+		json.RawMessage(`{"name":"datasource","type":"datasource"}`),
+		json.RawMessage(`{"name":"job","query":"a"}`),
+		json.RawMessage(`{"name":"instance"}`),
+	}
+	if diff := cmp.Diff(wanted, list); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindPanel(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Panel1","type":"graph"},
+			{"title":"Row","type":"row","collapsed":true,"panels":[{"title":"Nested","type":"graph","id":3}]}
+		]`),
+	}
+
+	p, ok := d.FindPanel("Nested")
+	if !ok {
+		t.Fatal("expected to find nested panel")
+	}
+	if id, _ := p.ID(); id != 3 {
+		t.Fatalf("unexpected panel id %d", id)
+	}
+	if _, ok := d.FindPanel("Missing"); ok {
+		t.Fatal("expected missing panel not to be found")
+	}
+	if _, ok := Dashboard(nil).FindPanel("Panel1"); ok {
+		t.Fatal("expected nil dashboard to have no panels")
+	}
+}
+
+func TestAllPanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"A","type":"row","collapsed":false,"panels":[]},
+			{"title":"A1","type":"graph"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"},{"title":"B2","type":"stat"}]}
+		]`),
+	}
+
+	var got []string
+	for _, p := range d.AllPanels() {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"Top", "A", "A1", "B", "B1", "B2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestAllPanelsWithRow(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"A","type":"row","collapsed":false,"panels":[]},
+			{"title":"A1","type":"graph"},
+			{"title":"A2","type":"graph"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"}]},
+			{"title":"C","type":"row","collapsed":false,"panels":[]},
+			{"title":"C1","type":"graph"}
+		]`),
+	}
+
+	type entry struct{ Title, Row string }
+	var got []entry
+	for _, p := range d.AllPanelsWithRow() {
+		title, _ := p.Panel.Title()
+		got = append(got, entry{title, p.Row})
+	}
+	want := []entry{
+		{"Top", ""},
+		{"A", ""}, {"A1", "A"}, {"A2", "A"},
+		{"B", ""}, {"B1", "B"},
+		{"C", ""}, {"C1", "C"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := (Dashboard{"panels": json.RawMessage(`{}`)}).AllPanelsWithRowE(); err == nil || !strings.Contains(err.Error(), "panels field is not an array") {
+		t.Fatalf("expected not an array error, got %v", err)
+	}
+}
+
+func TestPanelTypeCounts(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"Untyped"},
+			{"title":"A","type":"row","collapsed":false,"panels":[]},
+			{"title":"A1","type":"timeseries"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"}]}
+		]`),
+	}
+
+	got, err := d.PanelTypeCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"graph": 2, "timeseries": 1, "row": 2, "": 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := (Dashboard{"panels": json.RawMessage(`{}`)}).PanelTypeCounts(); err == nil {
+		t.Fatal("expected error for invalid panels")
+	}
+}
+
+func TestAllPanelsE(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		d    Dashboard
+		err  string
+	}{
+		{name: "not an array", d: Dashboard{"panels": json.RawMessage(`{}`)}, err: "panels field is not an array"},
+		{name: "malformed nested", d: Dashboard{"panels": json.RawMessage(`[{"title":"R","type":"row","panels":{}}]`)}, err: "unmarshal panels"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tc.d.AllPanelsE(); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+
+	ps, err := Dashboard{}.AllPanelsE()
+	if err != nil || len(ps) != 0 {
+		t.Fatalf("expected no panels and no error, got %v, %v", ps, err)
+	}
+}
+
+func TestPanelsOfType(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"A1","type":"timeseries"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"}]}
+		]`),
+	}
+
+	var got []string
+	for _, p := range d.PanelsOfType("graph") {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"Top", "B1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if ps := d.PanelsOfType("stat"); len(ps) != 0 {
+		t.Fatalf("expected no panels, got %d", len(ps))
+	}
+
+	ps, err := d.PanelsOfTypeE("graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 2 {
+		t.Fatalf("expected 2 graph panels, got %d", len(ps))
+	}
+	if _, err := (Dashboard{"panels": json.RawMessage(`[{"title":"R","type":"row","panels":{}}]`)}).PanelsOfTypeE("graph"); err == nil || !strings.Contains(err.Error(), "unmarshal panels") {
+		t.Fatalf("expected unmarshal panels error, got %v", err)
+	}
+}
+
+func TestMigratePanelType(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph","legend":{"show":true}},
+			{"title":"Stat","type":"stat"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"}]}
+		]`),
+	}
+
+	migrated, err := MigratePanelType(d, "graph", "timeseries", func(p Panel) Panel {
+		if legend, ok := p["legend"]; ok {
+			delete(p, "legend")
+			p["options"] = json.RawMessage(`{"legend":` + string(legend) + `}`)
+		}
+		return p
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[{"options":{"legend":{"show":true}},"title":"Top","type":"timeseries"},` +
+		`{"title":"Stat","type":"stat"},` +
+		`{"collapsed":true,"panels":[{"title":"B1","type":"timeseries"}],"title":"B","type":"row"}]`
+	if diff := cmp.Diff(want, string(migrated["panels"])); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if ps := d.PanelsOfType("graph"); len(ps) != 2 {
+		t.Fatalf("expected input dashboard to be unchanged, got %d graph panels", len(ps))
+	}
+}
+
+func TestWalkPanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"},{"title":"B2","type":"stat"}]},
+			{"title":"C","type":"graph"}
+		]`),
+	}
+
+	errStop := errors.New("stop")
+	var got []string
+	err := d.WalkPanels(func(p Panel) error {
+		title, _ := p.Title()
+		got = append(got, title)
+		if title == "B1" {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected walk to stop with %v, got %v", errStop, err)
+	}
+	want := []string{"Top", "B", "B1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestTransformPanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"},{"title":"B2","type":"stat"}]}
+		]`),
+	}
+
+	got, err := d.TransformPanels(func(p Panel) (Panel, error) {
+		if t, _ := p.Type(); t == "stat" {
+			return nil, nil
+		}
+		title, _ := p.Title()
+		return p, p.SetTitle(title + "!")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"title":"Top!","type":"graph"},{"collapsed":true,"panels":[{"title":"B1!","type":"graph"}],"title":"B!","type":"row"}]`
+	if diff := cmp.Diff(want, string(got["panels"])); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeDashboardsLinks(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"links": json.RawMessage(`[{"title":"Runbook","url":"https://a"},{"title":"Home","url":"/"}]`),
+	}
+	d2 := Dashboard{
+		"links": json.RawMessage(`[{"title":"Home","url":"/"},{"title":"Runbook","url":"https://b"}]`),
+	}
+
+	merged, err := MergeDashboards(d1, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"title":"Runbook","url":"https://a"},{"title":"Home","url":"/"},{"title":"Runbook","url":"https://b"}]`
+	if diff := cmp.Diff(want, string(merged["links"])); diff != "" {
+		t.Fatalf("unexpected links (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetAllRowsCollapsed(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Top","type":"graph"},
+			{"title":"A","type":"row","collapsed":false,"panels":[]},
+			{"title":"A1","type":"graph"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"B1","type":"graph"}]}
+		]`),
+	}
+
+	collapsed, err := d.SetAllRowsCollapsed(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"title":"Top","type":"graph"},` +
+		`{"collapsed":true,"panels":[{"title":"A1","type":"graph"}],"title":"A","type":"row"},` +
+		`{"collapsed":true,"panels":[{"title":"B1","type":"graph"}],"title":"B","type":"row"}]`
+	if diff := cmp.Diff(want, string(collapsed["panels"])); diff != "" {
+		t.Errorf("unexpected collapsed panels (-want +got):\n%s", diff)
+	}
+
+	expanded, err := collapsed.SetAllRowsCollapsed(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[{"title":"Top","type":"graph"},` +
+		`{"collapsed":false,"panels":[],"title":"A","type":"row"},{"title":"A1","type":"graph"},` +
+		`{"collapsed":false,"panels":[],"title":"B","type":"row"},{"title":"B1","type":"graph"}]`
+	if diff := cmp.Diff(want, string(expanded["panels"])); diff != "" {
+		t.Errorf("unexpected expanded panels (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetPanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{"title": json.RawMessage(`"Dash"`)}
+	ps := []Panel{
+		{"title": json.RawMessage(`"Top"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`true`), "panels": json.RawMessage(`[]`)},
+		{"title": json.RawMessage(`"A1"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`false`)},
+		{"title": json.RawMessage(`"B1"`), "type": json.RawMessage(`"graph"`)},
+	}
+
+	got, err := d.SetPanels(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"title":"Top","type":"graph"},` +
+		`{"collapsed":true,"panels":[{"title":"A1","type":"graph"}],"title":"A","type":"row"},` +
+		`{"collapsed":false,"title":"B","type":"row"},{"title":"B1","type":"graph"}]`
+	if diff := cmp.Diff(want, string(got["panels"])); diff != "" {
+		t.Errorf("unexpected panels (-want +got):\n%s", diff)
+	}
+	if _, ok := d["panels"]; ok {
+		t.Error("the input dashboard was modified")
+	}
+	if string(ps[1]["panels"]) != `[]` {
+		t.Error("the input panels were modified")
+	}
+}
+
+func TestMergeDashboardsTagLinks(t *testing.T) {
+	t.Parallel()
+
+	d1 := Dashboard{
+		"links": json.RawMessage(`[{"type":"dashboards","tags":["a"]},{"type":"dashboards","tags":["b"]}]`),
+	}
+	d2 := Dashboard{
+		"links": json.RawMessage(`[{"tags":["b"],"type":"dashboards"},{"type":"dashboards","tags":["c"]}]`),
+	}
+
+	tests := []struct {
+		name string
+		d2   Dashboard
+		want string
+	}{
+		{
+			name: "base only",
+			d2:   Dashboard{},
+			want: `[{"type":"dashboards","tags":["a"]},{"type":"dashboards","tags":["b"]}]`,
+		},
+		{
+			name: "union",
+			d2:   d2,
+			want: `[{"type":"dashboards","tags":["a"]},{"type":"dashboards","tags":["b"]},{"type":"dashboards","tags":["c"]}]`,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			merged, err := MergeDashboards(d1, tc.d2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, string(merged["links"])); diff != "" {
+				t.Fatalf("unexpected links (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindPanelE(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		d     Dashboard
+		found bool
+		err   string
+	}{
+		{name: "found", d: Dashboard{"panels": json.RawMessage(`[{"title":"A","type":"graph"}]`)}, found: true},
+		{name: "not found", d: Dashboard{"panels": json.RawMessage(`[{"title":"B","type":"graph"}]`)}},
+		{name: "no panels", d: Dashboard{}},
+		{name: "not an array", d: Dashboard{"panels": json.RawMessage(`{}`)}, err: "panels field is not an array"},
+		{name: "malformed nested", d: Dashboard{"panels": json.RawMessage(`[{"title":"R","type":"row","panels":{}}]`)}, err: "unmarshal panels"},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, found, err := tc.d.FindPanelE("A")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				if _, ok := tc.d.FindPanel("A"); ok {
+					t.Fatal("expected FindPanel to report malformed panels as not found")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tc.found {
+				t.Fatalf("expected found %v, got %v", tc.found, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DatasourceRef is a reference to a datasource.
+//
+// Older dashboards reference datasources by name, e.g. "datasource": "Prometheus",
+// in that case only Name is set. Newer dashboards use an object with the
+// datasource type and uid, e.g. "datasource": {"type": "prometheus", "uid": "abc"}.
+type DatasourceRef struct {
+	Name string `json:"-"`
+	Type string `json:"type,omitempty"`
+	UID  string `json:"uid,omitempty"`
+}
+
+// IsLegacy reports whether the reference uses the legacy string form.
+func (r DatasourceRef) IsLegacy() bool {
+	return r.Name != "" && r.Type == "" && r.UID == ""
+}
+
+type datasourceRefObject DatasourceRef
+
+func (r *DatasourceRef) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*r = DatasourceRef{}
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		*r = DatasourceRef{}
+		return json.Unmarshal(data, &r.Name)
+	}
+
+	var obj datasourceRefObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*r = DatasourceRef(obj)
+	return nil
+}
+
+func (r DatasourceRef) MarshalJSON() ([]byte, error) {
+	if r.IsLegacy() {
+		return json.Marshal(r.Name)
+	}
+	return json.Marshal(datasourceRefObject(r))
+}
+
+// Datasource returns the raw datasource field of the panel and whether it is present.
+func (p Panel) Datasource() (json.RawMessage, bool) {
+	raw, ok := p["datasource"]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return nil, false
+	}
+	return raw, true
+}
+
+// DatasourceRef returns the parsed datasource field of the panel and whether it is present and valid.
+func (p Panel) DatasourceRef() (DatasourceRef, bool) {
+	raw, ok := p.Datasource()
+	if !ok {
+		return DatasourceRef{}, false
+	}
+	var ref DatasourceRef
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return DatasourceRef{}, false
+	}
+	return ref, true
+}
+
+// RemapDatasources returns a copy of the dashboard where the datasource uids of every panel
+// and of every panel target are replaced according to mapping, including panels nested in rows.
+// Uids that are not in mapping and datasources in the legacy string form are left untouched.
+func RemapDatasources(d Dashboard, mapping map[string]string) (Dashboard, error) {
+	return d.TransformPanels(func(p Panel) (Panel, error) {
+		if raw, ok := p["datasource"]; ok {
+			remapped, err := remapDatasource(raw, mapping)
+			if err != nil {
+				return nil, newMergeError(p, "datasource", err)
+			}
+			p["datasource"] = remapped
+		}
+
+		raw, ok := p["targets"]
+		if !ok {
+			return p, nil
+		}
+		var targets []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &targets); err != nil {
+			return nil, newMergeError(p, "targets", fmt.Errorf("unmarshal targets: %w", err))
+		}
+		for _, t := range targets {
+			if raw, ok := t["datasource"]; ok {
+				remapped, err := remapDatasource(raw, mapping)
+				if err != nil {
+					return nil, newMergeError(p, "targets", err)
+				}
+				t["datasource"] = remapped
+			}
+		}
+		return p, setField(p, "targets", targets)
+	})
+}
+
+// builtinDatasourceUIDs are the uids of the datasources that exist in every Grafana instance.
+var builtinDatasourceUIDs = map[string]bool{
+	"grafana":         true,
+	"-- Grafana --":   true,
+	"-- Mixed --":     true,
+	"-- Dashboard --": true,
+}
+
+// PrunePanels returns a copy of the dashboard without the panels, including panels nested in rows,
+// that reference a datasource uid that is not in validUIDs, either directly or from a target.
+// It also returns the removed panels.
+//
+// Rows, datasources in the legacy string form, template variables like ${datasource}
+// and the built-in Grafana datasources are never considered invalid.
+// It returns an error if the panels, their datasources or their targets cannot be unmarshalled.
+func PrunePanels(d Dashboard, validUIDs map[string]bool) (Dashboard, []Panel, error) {
+	var pruned []Panel
+	res, err := d.TransformPanels(func(p Panel) (Panel, error) {
+		if p.isRow() {
+			return p, nil
+		}
+		uids, err := datasourceUIDs(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			if !validUIDs[uid] && !builtinDatasourceUIDs[uid] && !strings.HasPrefix(uid, "$") {
+				pruned = append(pruned, p)
+				return nil, nil
+			}
+		}
+		return p, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, pruned, nil
+}
+
+// datasourceUIDs returns the datasource uids referenced by the panel and by its targets.
+// References that do not have a uid are ignored.
+func datasourceUIDs(p Panel) ([]string, error) {
+	var uids []string
+	if raw, ok := p.Datasource(); ok {
+		var ref DatasourceRef
+		if err := json.Unmarshal(raw, &ref); err != nil {
+			return nil, newMergeError(p, "datasource", fmt.Errorf("unmarshal datasource: %w", err))
+		}
+		if ref.UID != "" {
+			uids = append(uids, ref.UID)
+		}
+	}
+
+	raw, ok := p["targets"]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return uids, nil
+	}
+	var targets []struct {
+		Datasource *DatasourceRef `json:"datasource"`
+	}
+	if err := json.Unmarshal(raw, &targets); err != nil {
+		return nil, newMergeError(p, "targets", fmt.Errorf("unmarshal targets: %w", err))
+	}
+	for _, t := range targets {
+		if t.Datasource != nil && t.Datasource.UID != "" {
+			uids = append(uids, t.Datasource.UID)
+		}
+	}
+	return uids, nil
+}
+
+// remapDatasource replaces the uid of a datasource object according to mapping,
+// preserving the other fields of the object.
+func remapDatasource(raw json.RawMessage, mapping map[string]string) (json.RawMessage, error) {
+	var ref DatasourceRef
+	if err := json.Unmarshal(raw, &ref); err != nil {
+		return nil, fmt.Errorf("unmarshal datasource: %w", err)
+	}
+	uid, ok := mapping[ref.UID]
+	if ref.IsLegacy() || ref.UID == "" || !ok {
+		return raw, nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("unmarshal datasource: %w", err)
+	}
+	if err := setField(obj, "uid", uid); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDatasourceRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		raw    string
+		wanted DatasourceRef
+	}{
+		{
+			name:   "legacy",
+			raw:    `"Prometheus"`,
+			wanted: DatasourceRef{Name: "Prometheus"},
+		},
+		{
+			name:   "object",
+			raw:    `{"type":"prometheus","uid":"abc"}`,
+			wanted: DatasourceRef{Type: "prometheus", UID: "abc"},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{"datasource": json.RawMessage(tc.raw)}
+			ref, ok := p.DatasourceRef()
+			if !ok {
+				t.Fatal("expected datasource to be present")
+			}
+			if diff := cmp.Diff(tc.wanted, ref); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+			b, err := json.Marshal(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.raw, string(b)); diff != "" {
+				t.Fatalf("unexpected round trip (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemapDatasources(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"type":"graph","datasource":{"type":"prometheus","uid":"staging"},"targets":[{"datasource":{"type":"prometheus","uid":"staging"},"expr":"up"}]},
+			{"type":"row","collapsed":true,"panels":[{"type":"graph","datasource":{"type":"loki","uid":"other"}},{"type":"graph","datasource":"Prometheus"}]}
+		]`),
+	}
+
+	res, err := RemapDatasources(d, map[string]string{"staging": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := res.MarshalCanonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"panels":[` +
+		`{"datasource":{"type":"prometheus","uid":"prod"},"targets":[{"datasource":{"type":"prometheus","uid":"prod"},"expr":"up"}],"type":"graph"},` +
+		`{"collapsed":true,"panels":[{"datasource":{"type":"loki","uid":"other"},"type":"graph"},{"datasource":"Prometheus","type":"graph"}],"type":"row"}` +
+		`]}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrunePanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Valid","datasource":{"type":"prometheus","uid":"prom"}},
+			{"title":"Invalid","datasource":{"type":"prometheus","uid":"other"}},
+			{"title":"Variable","datasource":{"uid":"${datasource}"}},
+			{"title":"Legacy","datasource":"Prometheus"},
+			{"title":"Row","type":"row","collapsed":true,"datasource":{"uid":"other"},"panels":[
+				{"title":"Mixed","datasource":{"uid":"-- Mixed --"},"targets":[{"datasource":{"uid":"prom"}},{"datasource":{"uid":"loki"}}]},
+				{"title":"Text","type":"text"}
+			]}
+		]`),
+	}
+
+	res, pruned, err := PrunePanels(d, map[string]bool{"prom": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range pruned {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	if diff := cmp.Diff([]string{"Invalid", "Mixed"}, got); diff != "" {
+		t.Errorf("unexpected pruned panels (-want +got):\n%s", diff)
+	}
+
+	got = nil
+	for _, p := range res.AllPanels() {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	if diff := cmp.Diff([]string{"Valid", "Variable", "Legacy", "Row", "Text"}, got); diff != "" {
+		t.Errorf("unexpected remaining panels (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrunePanelsMalformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		panels  string
+		wantErr string
+	}{
+		{
+			name:    "panels",
+			panels:  `{"title":"Panel1"}`,
+			wantErr: "not an array",
+		},
+		{
+			name:    "datasource",
+			panels:  `[{"title":"Panel1","datasource":42}]`,
+			wantErr: "unmarshal datasource",
+		},
+		{
+			name:    "targets",
+			panels:  `[{"title":"Panel1","targets":{"expr":"up"}}]`,
+			wantErr: "unmarshal targets",
+		},
+		{
+			name:    "target datasource",
+			panels:  `[{"type":"row","collapsed":true,"panels":[{"title":"Panel1","targets":[{"datasource":[]}]}]}]`,
+			wantErr: "unmarshal targets",
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d := Dashboard{"panels": json.RawMessage(tc.panels)}
+			if _, _, err := PrunePanels(d, map[string]bool{"prom": true}); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
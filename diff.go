@@ -0,0 +1,231 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+)
+
+// DiffPanels compares two sets of panels using the same matching as MergePanels.
+//
+// It returns the panels in new that do not match any panel in old,
+// the panels in old that do not match any panel in new,
+// and the panels in new that match a panel in old but have a different content.
+// The gridPos and id fields are not considered part of the content.
+func DiffPanels(old, new []Panel, opts ...Option) (added, removed, changed []Panel) {
+	o := newOptions(opts)
+
+	matched := make([]bool, len(old))
+	for _, pn := range new {
+		i := -1
+		for j, po := range old {
+			if !matched[j] && o.match(po, pn) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			added = append(added, pn)
+			continue
+		}
+
+		matched[i] = true
+		if !o.sameContent(old[i], pn) {
+			changed = append(changed, pn)
+		}
+	}
+
+	for i, po := range old {
+		if !matched[i] {
+			removed = append(removed, po)
+		}
+	}
+
+	return added, removed, changed
+}
+
+// volatileFields are the panel fields that describe where a panel is rather than what it is.
+var volatileFields = map[string]bool{
+	"gridPos": true,
+	"id":      true,
+}
+
+// DeepEquals reports whether the panels have exactly the same content, including
+// position and id, ignoring insignificant whitespace and the order of object keys,
+// see WithIgnoreDatasourceFormat.
+func (p Panel) DeepEquals(p2 Panel, opts ...Option) bool {
+	o := newOptions(opts)
+	p, p2 = o.align(o.normalize(p), o.normalize(p2))
+	if len(p) != len(p2) {
+		return false
+	}
+	for k, v := range p {
+		if w, ok := p2[k]; !ok || !rawEqual(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameContent reports whether the panels have the same content according to the options.
+func (o options) sameContent(a, b Panel) bool {
+	return contentEqual(o.align(o.normalize(a), o.normalize(b)))
+}
+
+// contentEqual reports whether the panels have the same content,
+// ignoring volatile fields and insignificant JSON differences.
+func contentEqual(a, b Panel) bool {
+	for k, v := range a {
+		if volatileFields[k] {
+			continue
+		}
+		if w, ok := b[k]; !ok || !rawEqual(v, w) {
+			return false
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok && !volatileFields[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// ContentHash returns a stable hash of the panel content.
+// The volatile gridPos and id fields are excluded and object keys are sorted,
+// so panels that differ only by position have the same hash.
+//
+// With WithIgnoreDatasourceFormat the datasource references are left out of the hash,
+// since the hash of a single panel cannot depend on the form used by another panel,
+// so panels that differ only by their datasources have the same hash, use Panel.DeepEquals to tell them apart.
+func (p Panel) ContentHash(opts ...Option) string {
+	o := newOptions(opts)
+	p = o.normalize(p)
+	if o.ignoreDatasourceFormat {
+		p = withoutDatasources(p)
+	}
+
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		if !volatileFields[k] {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		v, err := canonicalize(p[k])
+		if err != nil {
+			v = p[k]
+		}
+		// keys are quoted so that they cannot be confused with the values
+		kb, _ := json.Marshal(k)
+		h.Write(kb)
+		h.Write([]byte{':'})
+		h.Write(v)
+		h.Write([]byte{','})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalize returns the panel as it should be compared according to the options.
+func (o options) normalize(p Panel) Panel {
+	if o.normalizeMappings {
+		p = normalizeMappings(p)
+	}
+	return p
+}
+
+// align returns the panels as they should be compared to each other according to the options,
+// see WithIgnoreDatasourceFormat.
+func (o options) align(a, b Panel) (Panel, Panel) {
+	if o.ignoreDatasourceFormat {
+		a, b = alignDatasources(a, b)
+	}
+	return a, b
+}
+
+// alignDatasources returns copies of the panels without the datasource references that have
+// a different form in the two panels, a name in one and a {"type", "uid"} object in the other,
+// both for the panels and for the targets at the same index. The other references are kept.
+func alignDatasources(a, b Panel) (Panel, Panel) {
+	a, b = a.Clone(), b.Clone()
+	if differentDatasourceForms(a["datasource"], b["datasource"]) {
+		delete(a, "datasource")
+		delete(b, "datasource")
+	}
+
+	var ta, tb []map[string]json.RawMessage
+	if json.Unmarshal(a["targets"], &ta) != nil || json.Unmarshal(b["targets"], &tb) != nil {
+		return a, b
+	}
+	changed := false
+	for i := 0; i < min(len(ta), len(tb)); i++ {
+		if differentDatasourceForms(ta[i]["datasource"], tb[i]["datasource"]) {
+			delete(ta[i], "datasource")
+			delete(tb[i], "datasource")
+			changed = true
+		}
+	}
+	if !changed {
+		return a, b
+	}
+	rawA, errA := json.Marshal(ta)
+	rawB, errB := json.Marshal(tb)
+	if errA == nil && errB == nil {
+		a["targets"], b["targets"] = rawA, rawB
+	}
+	return a, b
+}
+
+// differentDatasourceForms reports whether one of the datasource references is a name
+// and the other a {"type", "uid"} object.
+func differentDatasourceForms(a, b json.RawMessage) bool {
+	ka, kb := jsonKind(a), jsonKind(b)
+	return ka == "string" && kb == "object" || ka == "object" && kb == "string"
+}
+
+// withoutDatasources returns a copy of the panel without the datasource references
+// of the panel and of its targets. Targets that cannot be unmarshalled are kept as they are.
+func withoutDatasources(p Panel) Panel {
+	p = p.Clone()
+	delete(p, "datasource")
+
+	raw, ok := p["targets"]
+	if !ok {
+		return p
+	}
+	var targets []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &targets); err != nil {
+		return p
+	}
+	for _, t := range targets {
+		delete(t, "datasource")
+	}
+	if raw, err := json.Marshal(targets); err == nil {
+		p["targets"] = raw
+	}
+	return p
+}
+
+// rawEqual reports whether two JSON values are equal, ignoring whitespace and key order.
+// Values that are not valid JSON are compared byte by byte.
+func rawEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	ca, err := canonicalize(a)
+	if err != nil {
+		return false
+	}
+	cb, err := canonicalize(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ca, cb)
+}
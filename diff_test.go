@@ -0,0 +1,159 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffPanels(t *testing.T) {
+	t.Parallel()
+
+	old := []Panel{
+		{"title": json.RawMessage(`"Same"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{"a":1,"b":2}`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"Changed"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{"a":1}`)},
+		{"title": json.RawMessage(`"Removed"`), "type": json.RawMessage(`"graph"`)},
+	}
+	new := []Panel{
+		{"title": json.RawMessage(`"Same"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{ "b": 2, "a": 1 }`), "id": json.RawMessage(`5`)},
+		{"title": json.RawMessage(`"Changed"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{"a":2}`)},
+		{"title": json.RawMessage(`"Added"`), "type": json.RawMessage(`"graph"`)},
+	}
+
+	added, removed, changed := DiffPanels(old, new)
+	if diff := cmp.Diff([]Panel{new[2]}, added); diff != "" {
+		t.Errorf("unexpected added (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Panel{old[2]}, removed); diff != "" {
+		t.Errorf("unexpected removed (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Panel{new[1]}, changed); diff != "" {
+		t.Errorf("unexpected changed (-want +got):\n%s", diff)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	p1 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{"a":1,"b":[1,2]}`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`), "id": json.RawMessage(`1`)}
+	p2 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{"b":[1, 2], "a":1}`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":6,"y":8}`), "id": json.RawMessage(`7`)}
+	p3 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{"a":1,"b":[2,1]}`)}
+
+	if p1.ContentHash() != p2.ContentHash() {
+		t.Error("expected panels differing only by position to have the same hash")
+	}
+	if p1.ContentHash() == p3.ContentHash() {
+		t.Error("expected panels with different content to have different hashes")
+	}
+}
+
+func TestDeepEquals(t *testing.T) {
+	t.Parallel()
+
+	p1 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{"a":1,"b":2}`), "id": json.RawMessage(`1`)}
+	p2 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{ "b": 2, "a": 1 }`), "id": json.RawMessage(`1`)}
+	p3 := Panel{"title": json.RawMessage(`"Panel1"`), "options": json.RawMessage(`{"a":1,"b":2}`), "id": json.RawMessage(`2`)}
+
+	if !p1.DeepEquals(p2) {
+		t.Error("expected panels differing only by formatting to be equal")
+	}
+	if p1.DeepEquals(p3) {
+		t.Error("expected panels with different ids to differ")
+	}
+}
+
+func TestIgnoreDatasourceFormat(t *testing.T) {
+	t.Parallel()
+
+	p1 := Panel{
+		"title":      json.RawMessage(`"Panel1"`),
+		"datasource": json.RawMessage(`"Prometheus"`),
+		"targets":    json.RawMessage(`[{"expr":"up","datasource":"Prometheus"}]`),
+	}
+	p2 := Panel{
+		"title":      json.RawMessage(`"Panel1"`),
+		"datasource": json.RawMessage(`{"type":"prometheus","uid":"abc"}`),
+		"targets":    json.RawMessage(`[{"expr":"up","datasource":{"type":"prometheus","uid":"abc"}}]`),
+	}
+
+	if p1.DeepEquals(p2) || p1.ContentHash() == p2.ContentHash() {
+		t.Fatal("expected panels with different datasources to differ by default")
+	}
+	if !p1.DeepEquals(p2, WithIgnoreDatasourceFormat()) {
+		t.Error("expected panels differing only by datasource format to be equal")
+	}
+	if p1.ContentHash(WithIgnoreDatasourceFormat()) != p2.ContentHash(WithIgnoreDatasourceFormat()) {
+		t.Error("expected panels differing only by datasource format to have the same hash")
+	}
+	if _, _, changed := DiffPanels([]Panel{p1}, []Panel{p2}, WithIgnoreDatasourceFormat()); len(changed) != 0 {
+		t.Errorf("unexpected changed panels %v", changed)
+	}
+	if _, ok := p1["datasource"]; !ok {
+		t.Error("expected input panel not to be modified")
+	}
+}
+
+func TestIgnoreDatasourceFormatSameForm(t *testing.T) {
+	t.Parallel()
+
+	panel := func(ds string) Panel {
+		return Panel{
+			"title":      json.RawMessage(`"Panel1"`),
+			"datasource": json.RawMessage(ds),
+			"targets":    json.RawMessage(`[{"expr":"up","datasource":` + ds + `}]`),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		p1, p2 Panel
+		wanted bool
+	}{
+		{
+			name:   "same uid",
+			p1:     panel(`{"type":"prometheus","uid":"prom-eu"}`),
+			p2:     panel(`{"uid":"prom-eu","type":"prometheus"}`),
+			wanted: true,
+		},
+		{
+			name: "different uids",
+			p1:   panel(`{"type":"prometheus","uid":"prom-eu"}`),
+			p2:   panel(`{"type":"loki","uid":"loki"}`),
+		},
+		{
+			name: "different names",
+			p1:   panel(`"Prometheus"`),
+			p2:   panel(`"Loki"`),
+		},
+		{
+			name:   "different forms",
+			p1:     panel(`"Prometheus"`),
+			p2:     panel(`{"type":"loki","uid":"loki"}`),
+			wanted: true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			opt := WithIgnoreDatasourceFormat()
+			if got := tc.p1.DeepEquals(tc.p2, opt); got != tc.wanted {
+				t.Errorf("DeepEquals: expected %v, got %v", tc.wanted, got)
+			}
+			if _, _, changed := DiffPanels([]Panel{tc.p1}, []Panel{tc.p2}, opt); (len(changed) == 0) != tc.wanted {
+				t.Errorf("DiffPanels: unexpected changed panels %v", changed)
+			}
+			want := 2
+			if tc.wanted {
+				want = 1
+			}
+			if got := DedupePanels([]Panel{tc.p1, tc.p2}, opt); len(got) != want {
+				t.Errorf("DedupePanels: expected %d panels, got %d", want, len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import "fmt"
+
+// MergeError is the error returned when a field of a panel cannot be marshalled or unmarshalled.
+// The merge functions that do not return an error panic with a *MergeError instead.
+type MergeError struct {
+	// Title is the title of the panel, empty if the panel has none.
+	Title string
+	// ID is the id of the panel, it is valid only if HasID is true.
+	ID    int
+	HasID bool
+	// Field is the name of the panel field that failed, e.g. "gridPos".
+	Field string
+	// Err is the underlying error.
+	Err error
+}
+
+func newMergeError(p Panel, field string, err error) *MergeError {
+	e := &MergeError{
+		Field: field,
+		Err:   err,
+	}
+	e.Title, _ = p.Title()
+	e.ID, e.HasID = p.ID()
+	return e
+}
+
+func (e *MergeError) Error() string {
+	if e.HasID {
+		return fmt.Sprintf("panel %q (id %d): %v", e.Title, e.ID, e.Err)
+	}
+	return fmt.Sprintf("panel %q: %v", e.Title, e.Err)
+}
+
+func (e *MergeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMergeError(t *testing.T) {
+	t.Parallel()
+
+	bad := Panel{
+		"title":   json.RawMessage(`"Broken"`),
+		"type":    json.RawMessage(`"graph"`),
+		"id":      json.RawMessage(`7`),
+		"gridPos": json.RawMessage(`{"h":"tall"}`),
+	}
+	ok := Panel{
+		"title": json.RawMessage(`"Ok"`),
+		"type":  json.RawMessage(`"graph"`),
+	}
+
+	check := func(t *testing.T, err error) {
+		t.Helper()
+		var me *MergeError
+		if !errors.As(err, &me) {
+			t.Fatalf("expected a *MergeError, got %v", err)
+		}
+		if me.Title != "Broken" || me.ID != 7 || !me.HasID || me.Field != "gridPos" {
+			t.Fatalf("unexpected error %+v", me)
+		}
+	}
+
+	_, err := MergePanelsE([]Panel{bad}, []Panel{ok})
+	check(t, err)
+
+	_, err = MergePanelsByGroupE([]Panel{bad}, []Panel{ok}, false)
+	check(t, err)
+
+	raw, _ := json.Marshal([]Panel{bad})
+	_, err = MergeDashboards(Dashboard{"panels": raw}, Dashboard{})
+	check(t, err)
+
+	// appended panels keep their size, so their gridPos is read too
+	_, err = MergePanelsE([]Panel{ok}, []Panel{bad})
+	check(t, err)
+
+	_, err = PreviewMerge([]Panel{ok}, []Panel{bad})
+	check(t, err)
+
+	_, err = MergePanelsByGroupE([]Panel{ok}, []Panel{bad}, false)
+	check(t, err)
+
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			check(t, err)
+		}()
+		MergePanels([]Panel{bad}, []Panel{ok})
+	}()
+
+	if _, err := MergePanelsE([]Panel{ok}, []Panel{ok}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -5,34 +5,158 @@ package dashboardfusion
 import (
 	"bytes"
 	"encoding/json"
-	"slices"
+	"fmt"
+	"strconv"
 )
 
 type Dashboard map[string]json.RawMessage
 
+// Clone returns a deep copy of the dashboard.
+func (d Dashboard) Clone() Dashboard {
+	if d == nil {
+		return nil
+	}
+	c := make(Dashboard, len(d))
+	for k, v := range d {
+		c[k] = bytes.Clone(v)
+	}
+	return c
+}
+
+// ParseDashboard parses the JSON-encoded dashboard in data.
+// It returns an error if data is not a JSON object or if its panels field is present but not an array.
+func ParseDashboard(data []byte) (Dashboard, error) {
+	if k := jsonKind(data); k != "object" {
+		return nil, fmt.Errorf("dashboard is not an object, got %s", k)
+	}
+	var d Dashboard
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("unmarshal dashboard: %w", err)
+	}
+	if err := checkPanelsField(d["panels"]); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkPanelsField returns an error if raw is neither absent, null nor an array.
+func checkPanelsField(raw json.RawMessage) error {
+	if raw == nil {
+		return nil
+	}
+	if k := jsonKind(raw); k != "array" && k != "null" {
+		return fmt.Errorf("panels field is not an array, got %s", k)
+	}
+	return nil
+}
+
+// Panels is like PanelsE but panics on error.
 func (d Dashboard) Panels() []Panel {
+	panels, err := d.PanelsE()
+	if err != nil {
+		panic(err)
+	}
+	return panels
+}
+
+// PanelsE returns the top-level panels of the dashboard.
+// It returns nil if the dashboard has no panels field.
+func (d Dashboard) PanelsE() ([]Panel, error) {
 	if ps, ok := d["panels"]; ok {
+		if err := checkPanelsField(ps); err != nil {
+			return nil, err
+		}
 		var panels []Panel
 		if err := json.Unmarshal(ps, &panels); err != nil {
-			panic(err)
+			return nil, fmt.Errorf("unmarshal panels: %w", err)
 		}
-		return panels
+		return panels, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 type Panel map[string]json.RawMessage
 
+// Equals reports whether the panels have the same title and type
+// and are repeated by the same variable, if any, see Panel.Repeat.
+// Absent, null and empty values are considered the same.
+// Panels without a title, e.g. text panels, only match panels without a title
+// that have the same content, ignoring gridPos and id.
 func (p Panel) Equals(p2 Panel) bool {
-	return bytes.Equal(p["title"], p2["title"]) &&
-		bytes.Equal(p["type"], p2["type"])
+	t1, t2 := normalizeRaw(p["title"]), normalizeRaw(p2["title"])
+	if t1 == nil || t2 == nil {
+		return t1 == nil && t2 == nil && contentEqual(p, p2)
+	}
+	return bytes.Equal(t1, t2) &&
+		bytes.Equal(normalizeRaw(p["type"]), normalizeRaw(p2["type"])) &&
+		bytes.Equal(normalizeRaw(p["repeat"]), normalizeRaw(p2["repeat"]))
+}
+
+// normalizeRaw returns nil for absent, null and empty string values.
+func normalizeRaw(raw json.RawMessage) json.RawMessage {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) || bytes.Equal(raw, []byte(`""`)) {
+		return nil
+	}
+	return raw
+}
+
+// jsonKind returns the kind of the JSON value in raw, based on its first character.
+func jsonKind(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "nothing"
+	}
+	switch raw[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// Clone returns a deep copy of the panel.
+func (p Panel) Clone() Panel {
+	if p == nil {
+		return nil
+	}
+	c := make(Panel, len(p))
+	for k, v := range p {
+		c[k] = bytes.Clone(v)
+	}
+	return c
 }
 
 func (p Panel) IDRaw() json.RawMessage {
 	return p["id"]
 }
 
+// ID returns the panel id and whether it is present.
+func (p Panel) ID() (int, bool) {
+	return intField(p, "id")
+}
+
+func intField(m map[string]json.RawMessage, key string) (int, bool) {
+	raw, ok := m[key]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return 0, false
+	}
+	var i int
+	if err := json.Unmarshal(raw, &i); err != nil {
+		return 0, false
+	}
+	return i, true
+}
+
 func (p Panel) GridPosRaw() json.RawMessage {
 	return p["gridPos"]
 }
@@ -49,16 +173,139 @@ func (p Panel) PanelsRaw() json.RawMessage {
 	return p["panels"]
 }
 
+// Targets returns the elements of the panel targets array and whether it is present.
+func (p Panel) Targets() ([]json.RawMessage, bool) {
+	return p.arrayField("targets")
+}
+
+// Transformations returns the elements of the panel transformations array and whether it is present.
+func (p Panel) Transformations() ([]json.RawMessage, bool) {
+	return p.arrayField("transformations")
+}
+
+func (p Panel) arrayField(key string) ([]json.RawMessage, bool) {
+	raw, ok := p[key]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return nil, false
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, false
+	}
+	return elems, true
+}
+
+// Title returns the panel title and whether it is present.
+// A JSON null title is reported as absent.
+func (p Panel) Title() (string, bool) {
+	return p.stringField("title")
+}
+
+// Type returns the panel type and whether it is present.
+// A JSON null type is reported as absent.
+func (p Panel) Type() (string, bool) {
+	return p.stringField("type")
+}
+
+// Description returns the panel description and whether it is present.
+// A JSON null description is reported as absent.
+func (p Panel) Description() (string, bool) {
+	return p.stringField("description")
+}
+
+// LibraryPanel returns the raw libraryPanel reference of the panel and whether it is present.
+// Library panels are stored in Grafana separately from the dashboard, which only
+// references them by uid and name.
+func (p Panel) LibraryPanel() (json.RawMessage, bool) {
+	raw, ok := p["libraryPanel"]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return nil, false
+	}
+	return raw, true
+}
+
+// Repeat returns the name of the template variable the panel is repeated by
+// and whether the panel is repeated.
+func (p Panel) Repeat() (string, bool) {
+	r, ok := p.stringField("repeat")
+	return r, ok && r != ""
+}
+
+func (p Panel) stringField(key string) (string, bool) {
+	return stringField(p, key)
+}
+
+func stringField(m map[string]json.RawMessage, key string) (string, bool) {
+	raw, ok := m[key]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// GridPos is like GridPosE but panics on error.
 func (p Panel) GridPos() GridPos {
+	gridPos, err := p.GridPosE()
+	if err != nil {
+		panic(err)
+	}
+	return gridPos
+}
+
+// GridPosE returns the grid position of the panel.
+// It returns the zero value if the panel has no gridPos field.
+func (p Panel) GridPosE() (GridPos, error) {
 	if gp, ok := p["gridPos"]; ok {
 		var gridPos GridPos
 		if err := json.Unmarshal(gp, &gridPos); err != nil {
-			panic(err)
+			return GridPos{}, newMergeError(p, "gridPos", fmt.Errorf("unmarshal gridPos: %w", err))
 		}
-		return gridPos
+		return gridPos, nil
 	}
 
-	return GridPos{}
+	return GridPos{}, nil
+}
+
+// SetGridPos sets the grid position of the panel.
+func (p Panel) SetGridPos(gp GridPos) error {
+	return p.setField("gridPos", gp)
+}
+
+// SetID sets the panel id.
+func (p Panel) SetID(id int) error {
+	return p.setField("id", id)
+}
+
+// SetTitle sets the panel title.
+func (p Panel) SetTitle(title string) error {
+	return p.setField("title", title)
+}
+
+// SetDescription sets the panel description.
+func (p Panel) SetDescription(description string) error {
+	return p.setField("description", description)
+}
+
+// SetType sets the panel type.
+func (p Panel) SetType(t string) error {
+	return p.setField("type", t)
+}
+
+func (p Panel) setField(key string, v any) error {
+	return setField(p, key, v)
+}
+
+func setField(m map[string]json.RawMessage, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", key, err)
+	}
+	m[key] = raw
+	return nil
 }
 
 type GridPos struct {
@@ -69,216 +316,762 @@ type GridPos struct {
 }
 
 // MergePanels merges two sets of panels.
+// The input panels are not modified.
 //
 // If a panel in ps2 matches a panel in ps1, the panel in ps2 overwrites the
-// content of the panel in ps1, but preserves its position and id.
+// content of the panel in ps1, but preserves its position and id, see WithPreserveFields.
+// Only the first matching panel in ps1 is overwritten.
 //
 // If a panel in ps2 does not match any panel in ps1 it is appended and placed at the end of the dashboard.
-func MergePanels(ps1, ps2 []Panel) []Panel {
+// Appended panels keep their width and height, missing dimensions are taken from the default, see WithDefaultGridPos.
+//
+// By default panels are matched with Panel.Equals, see WithMatcher.
+// Appended panels are given a new id one higher than the maximum id in use, see WithPreserveIDs.
+//
+// If ps1 is empty the panels of ps2 are returned as they are, keeping their ids and grid positions.
+func MergePanels(ps1, ps2 []Panel, opts ...Option) []Panel {
+	ps, err := MergePanelsE(ps1, ps2, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// MergePanelsE is like MergePanels but returns a *MergeError instead of panicking
+// when a field of a panel cannot be unmarshalled.
+func MergePanelsE(ps1, ps2 []Panel, opts ...Option) ([]Panel, error) {
+	res, err := mergePanels(ps1, ps2, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return res.Panels, nil
+}
+
+// MergeResult is the result of MergePanelsWithResult.
+type MergeResult struct {
+	// Panels are the merged panels.
+	Panels []Panel
+	// Updated are the indices in Panels of the panels of ps1 overwritten by a matching panel.
+	Updated []int
+	// Appended are the indices in Panels of the panels of ps2 that did not match any panel.
+	Appended []int
+}
+
+// MergePanelsWithResult is like MergePanels but also reports which panels were
+// updated in place and which were appended.
+func MergePanelsWithResult(ps1, ps2 []Panel, opts ...Option) MergeResult {
+	res, err := mergePanels(ps1, ps2, newOptions(opts))
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func mergePanels(ps1, ps2 []Panel, o options) (MergeResult, error) {
+	if len(ps1) == 0 {
+		return appendToEmpty(ps2, o)
+	}
+
 	var maxY int
 	res := make([]Panel, 0, len(ps1)+len(ps2))
 	for _, p1 := range ps1 {
-		if gp := p1.GridPos(); gp.Y+gp.H > maxY {
-			maxY = gp.Y + gp.H
+		// account for the panels embedded in collapsed rows, which take their
+		// place in the grid once the row is expanded
+		for _, p := range liftEmbeddedPanels([]Panel{p1}) {
+			gp, err := p.GridPosE()
+			if err != nil {
+				return MergeResult{}, err
+			}
+			maxY = max(maxY, gp.Y+gp.H)
 		}
-		res = append(res, p1)
+		res = append(res, p1.Clone())
 	}
 
+	maxID := maxPanelID(ps1)
+	if o.maxID != nil {
+		maxID = max(maxID, *o.maxID)
+		defer func() { *o.maxID = maxID }()
+	}
+
+	// the row group of every panel, only panels in the same group match
+	groups1 := make([]string, len(res))
+	groups2 := make([]string, len(ps2))
+	if o.matchWithinRow {
+		groups1, groups2 = rowGroups(res), rowGroups(ps2)
+	}
+
+	idx := newMatchIndex(res, groups1, o)
+
+	var updated, appended []int
+	touched := make(map[int]bool)
 	for len(ps2) > 0 {
-		p2 := ps2[0]
-		ps2 = ps2[1:]
-
-		var matched bool
-		for i := range res {
-			if res[i].Equals(p2) {
-				// When we find a match, the panel's content is overwritten,
-				// except for the gridPos(to preserve the layout) and id.
-				p2["gridPos"], p2["id"] = res[i].GridPosRaw(), res[i].IDRaw()
-				res[i] = p2
-				matched = true
-			}
-		}
+		p2 := ps2[0].Clone()
+		group := groups2[0]
+		ps2, groups2 = ps2[1:], groups2[1:]
 
-		if !matched {
-			g := GridPos{
-				H: 2,
-				W: 6,
-				X: 0,
-				Y: maxY + 1,
+		if i := idx.find(res, p2, group); i >= 0 {
+			if o.onMatch != nil {
+				o.onMatch(res[i], p2)
 			}
-			graw, err := json.Marshal(g)
+			merged, err := mergeMatched(res[i], p2, o)
 			if err != nil {
-				panic(err)
+				return MergeResult{}, err
+			}
+			res[i] = merged
+			if !touched[i] {
+				updated = append(updated, i)
+				touched[i] = true
+			}
+		} else {
+			// Keep the size of the panel, only missing dimensions are
+			// taken from the default.
+			g := o.defaultGridPos
+			gp, err := p2.GridPosE()
+			if err != nil {
+				return MergeResult{}, err
+			}
+			if gp.W > 0 {
+				g.W = gp.W
+			}
+			if gp.H > 0 {
+				g.H = gp.H
+			}
+			g.Y = maxY + o.appendGap
+			if err := p2.SetGridPos(g); err != nil {
+				return MergeResult{}, err
+			}
+			if !o.preserveIDs {
+				maxID++
+				if err := p2.SetID(maxID); err != nil {
+					return MergeResult{}, err
+				}
 			}
-			p2["gridPos"] = graw
 
+			idx.add(p2, len(res), group)
+			touched[len(res)] = true
+			appended = append(appended, len(res))
 			res = append(res, p2)
-			maxY += g.H
+			maxY = g.Y + g.H
+		}
+	}
+
+	if o.sortAppended {
+		if err := sortAppended(res, appended, o); err != nil {
+			return MergeResult{}, err
 		}
 	}
 
+	// prefix the titles last, so that later panels of ps2 still match the appended ones
+	for _, i := range appended {
+		if err := addTitlePrefix(res[i], o.titlePrefix); err != nil {
+			return MergeResult{}, err
+		}
+	}
+
+	return MergeResult{
+		Panels:   res,
+		Updated:  updated,
+		Appended: appended,
+	}, nil
+}
+
+// sortAppended sorts the appended panels of res by title, the panels between two rows are sorted
+// separately and rows keep their place. The sorted panels are stacked again from the position
+// of the first appended panel and get the ids in order.
+func sortAppended(res []Panel, appended []int, o options) error {
+	panels := make([]Panel, len(appended))
+	ids := make([]int, len(appended))
+	for k, i := range appended {
+		panels[k] = res[i]
+		ids[k], _ = res[i].ID()
+	}
+
+	for start := 0; start < len(panels); {
+		end := start
+		for end < len(panels) && !panels[end].isRow() {
+			end++
+		}
+		sortPanelsByTitle(panels[start:end])
+		start = end + 1
+	}
+
+	first, err := res[appended[0]].GridPosE()
+	if err != nil {
+		return err
+	}
+	y := first.Y
+	for k, i := range appended {
+		p := panels[k]
+		gp, err := p.GridPosE()
+		if err != nil {
+			return err
+		}
+		gp.Y = y
+		if err := p.SetGridPos(gp); err != nil {
+			return err
+		}
+		y = gp.Y + gp.H + o.appendGap
+		if !o.preserveIDs {
+			if err := p.SetID(ids[k]); err != nil {
+				return err
+			}
+		}
+		res[i] = p
+	}
+	return nil
+}
+
+// appendToEmpty returns the result of merging ps into no panels, that is ps unchanged,
+// unless sorted or prefixed.
+// When the maximum id is shared with other merges, as in MergePanelsByGroup, the panels
+// get new ids so that they do not collide with the panels merged elsewhere, see WithPreserveIDs.
+func appendToEmpty(ps []Panel, o options) (MergeResult, error) {
+	res := clonePanels(ps)
+	var appended []int
+	for i := range res {
+		appended = append(appended, i)
+	}
+	if o.maxID != nil {
+		if o.preserveIDs {
+			*o.maxID = max(*o.maxID, maxPanelID(res))
+		} else {
+			for _, p := range res {
+				*o.maxID++
+				if err := p.SetID(*o.maxID); err != nil {
+					return MergeResult{}, err
+				}
+			}
+		}
+	}
+	if o.sortAppended && len(res) > 0 {
+		if err := sortAppended(res, appended, o); err != nil {
+			return MergeResult{}, err
+		}
+	}
+	for _, p := range res {
+		if err := addTitlePrefix(p, o.titlePrefix); err != nil {
+			return MergeResult{}, err
+		}
+	}
+	return MergeResult{
+		Panels:   res,
+		Appended: appended,
+	}, nil
+}
+
+// addTitlePrefix prepends prefix to the title of the panel, if any.
+func addTitlePrefix(p Panel, prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if title, ok := p.Title(); ok {
+		return p.SetTitle(prefix + title)
+	}
+	return nil
+}
+
+// matchIndex finds the first panel matching a given panel.
+// If the matcher provides a key, lookups use a map, otherwise they scan all the panels.
+// Panels only match panels of the same group, see WithMatchWithinRow.
+type matchIndex struct {
+	match  func(a, b Panel) bool
+	key    func(Panel) (string, bool)
+	byKey  map[string][]int
+	groups []string
+}
+
+func newMatchIndex(ps []Panel, groups []string, o options) *matchIndex {
+	idx := &matchIndex{
+		match: o.match,
+		key:   o.matchKey,
+	}
+	if idx.key != nil {
+		idx.byKey = make(map[string][]int, len(ps))
+	}
+	for i, p := range ps {
+		idx.add(p, i, groups[i])
+	}
+	return idx
+}
+
+// add records that p is at index i in the given group, it must be called in increasing order of i.
+func (idx *matchIndex) add(p Panel, i int, group string) {
+	idx.groups = append(idx.groups, group)
+	if idx.key == nil {
+		return
+	}
+	if k, ok := idx.key(p); ok {
+		k = group + "\x00" + k
+		idx.byKey[k] = append(idx.byKey[k], i)
+	}
+}
+
+// find returns the index of the first panel in ps of the given group matching p, or -1.
+func (idx *matchIndex) find(ps []Panel, p Panel, group string) int {
+	return idx.findUnused(ps, p, group, nil)
+}
+
+// findUnused is like find but skips the panels marked as used.
+func (idx *matchIndex) findUnused(ps []Panel, p Panel, group string, used []bool) int {
+	if idx.key == nil {
+		for i := range ps {
+			if idx.groups[i] == group && !(i < len(used) && used[i]) && idx.match(ps[i], p) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	k, ok := idx.key(p)
+	if !ok {
+		return -1
+	}
+	for _, i := range idx.byKey[group+"\x00"+k] {
+		if !(i < len(used) && used[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// equalsKey is the match key corresponding to Panel.Equals,
+// panels without a title are keyed by their content.
+func equalsKey(p Panel) (string, bool) {
+	t, title := normalizeRaw(p.TypeRaw()), normalizeRaw(p.TitleRaw())
+	if title == nil {
+		return "#" + p.ContentHash(), true
+	}
+	r := normalizeRaw(p["repeat"])
+	return fmt.Sprintf("%d:%s%d:%s%s", len(t), t, len(r), r, title), true
+}
+
+// MergeManyPanels merges the sets of panels from left to right,
+// each set is merged into the result of merging the previous ones as in MergePanels.
+func MergeManyPanels(sets ...[]Panel) []Panel {
+	var res []Panel
+	for i, ps := range sets {
+		if i == 0 {
+			res = clonePanels(ps)
+			continue
+		}
+		res = MergePanels(res, ps)
+	}
 	return res
 }
 
+func clonePanels(ps []Panel) []Panel {
+	if ps == nil {
+		return nil
+	}
+	res := make([]Panel, len(ps))
+	for i := range ps {
+		res[i] = ps[i].Clone()
+	}
+	return res
+}
+
+// mergeMatched returns the result of overwriting the old panel with the new, matching, panel.
+func mergeMatched(old, new Panel, o options) (Panel, error) {
+	// When we find a match, the panel's content is overwritten,
+	// except for the gridPos(to preserve the layout) and id.
+	if !o.preferNewLayout || new.GridPosRaw() == nil {
+		new["gridPos"] = old.GridPosRaw()
+	}
+	new["id"] = old.IDRaw()
+
+	for _, k := range o.preserveFields {
+		if v, ok := old[k]; ok {
+			new[k] = v
+		}
+	}
+
+	if o.mergeLinks {
+		l1, ok1 := old.Links()
+		l2, ok2 := new.Links()
+		if ok1 || ok2 {
+			if err := new.setField("links", unionLinks(l1, l2)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.mergeOverrides {
+		o1, ok1 := old.FieldOverrides()
+		o2, ok2 := new.FieldOverrides()
+		if ok1 || ok2 {
+			if err := new.setFieldOverrides(unionOverrides(o1, o2)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if o.keepTargets {
+		if _, ok := old.Targets(); ok {
+			if _, ok := new.Targets(); ok {
+				new["targets"] = old["targets"]
+			}
+		}
+	}
+
+	return new, nil
+}
+
+// maxPanelID returns the maximum id of the panels, including the panels nested in rows,
+// or 0 if no panel has an id.
+func maxPanelID(ps []Panel) int {
+	var maxID int
+	for _, p := range liftEmbeddedPanels(ps) {
+		if id, ok := p.ID(); ok && id > maxID {
+			maxID = id
+		}
+	}
+	return maxID
+}
+
 // MergePanelsByGroup merges two sets of panels
 // first by group and then, if possible, by panels name and type.
 // The new panels are appended to either top or bottom of the
-// res dashboard based on the value of the 'top' flag.
+// res dashboard based on the value of the 'top' flag, see also WithPlacement.
+// The input panels are not modified.
+//
+// Collapsed rows stay collapsed with their panels embedded, see WithExpandRows.
+// The options are passed to MergePanels when merging the panels of a group.
+// The rows and panels added from ps2 get new ids unique across all the groups, see WithPreserveIDs.
+//
+// The merged panels are laid out again unless their positions still form a valid layout,
+// so merging panels into themselves returns them unchanged,
+// see also WithBinPack, WithPreserveColumns and WithNoRelayout.
+func MergePanelsByGroup(ps1, ps2 []Panel, top bool, opts ...Option) []Panel {
+	ps, err := MergePanelsByGroupE(ps1, ps2, top, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// MergePanelsByGroupE is like MergePanelsByGroup but returns a *MergeError instead of panicking
+// when a field of a panel cannot be unmarshalled.
+func MergePanelsByGroupE(ps1, ps2 []Panel, top bool, opts ...Option) ([]Panel, error) {
+	o := newOptions(opts)
 
-func MergePanelsByGroup(ps1, ps2 []Panel, top bool) []Panel {
-	groupsPs1, rowsPs1 := groupByRow(ps1)
-	groupsPs2, rowsPs2 := groupByRow(ps2)
+	groupsPs1, rowsPs1, namesPs1 := groupByRow(ps1, o.expandRows)
+	groupsPs2, rowsPs2, namesPs2 := groupByRow(ps2, o.expandRows)
 
-	// merge child panels per group
+	// share the maximum id across groups so that appended panels get unique ids
+	var maxID int
+	for _, g := range groupsPs1 {
+		maxID = max(maxID, maxPanelID(g))
+	}
+	for _, r := range rowsPs1 {
+		maxID = max(maxID, maxPanelID([]Panel{r}))
+	}
+	opts = append(opts[:len(opts):len(opts)], withMaxID(&maxID))
+
+	// merge child panels per group, in document order to keep the result deterministic
 	mergedGroups := make(map[string][]Panel)
-	for name, g1 := range groupsPs1 {
+	for _, name := range namesPs1 {
+		g1 := groupsPs1[name]
 		if g2, ok := groupsPs2[name]; ok {
-			mergedGroups[name] = MergePanels(g1, g2)
+			merged, err := MergePanelsE(g1, g2, opts...)
+			if err != nil {
+				return nil, err
+			}
+			mergedGroups[name] = merged
 		} else {
 			mergedGroups[name] = g1
 		}
 	}
-	for name, g2 := range groupsPs2 {
-		if _, ok := mergedGroups[name]; !ok {
-			mergedGroups[name] = g2
+	for _, name := range namesPs2 {
+		if _, ok := mergedGroups[name]; ok {
+			continue
 		}
+		// the groups only in ps2 are new, so their row and panels get new ids too
+		if header, ok := rowsPs2[name]; ok && !o.preserveIDs {
+			maxID++
+			if err := header.SetID(maxID); err != nil {
+				return nil, err
+			}
+		}
+		merged, err := MergePanelsE(nil, groupsPs2[name], opts...)
+		if err != nil {
+			return nil, err
+		}
+		mergedGroups[name] = merged
+	}
+
+	placement := AppendBottom
+	if top {
+		placement = AppendTop
+	}
+	if o.placement != nil {
+		placement = *o.placement
 	}
 
 	tmp1 := make([]Panel, 0)
 	tmp2 := make([]Panel, 0)
 	seen := make(map[string]bool)
 
-	// check what rows belong only to ps2
-	var onlyPs2 []string
-
-	for title := range rowsPs2 {
-		if _, ok := rowsPs1[title]; !ok {
-			onlyPs2 = append(onlyPs2, title)
+	// groups that were only in ps2, in the order of ps2, grouped by the last
+	// row of ps1 preceding them in ps2
+	var anchor string
+	after := make(map[string][]Panel)
+	for _, title := range namesPs2 {
+		header, ok := rowsPs2[title]
+		if !ok {
+			continue
 		}
-	}
-
-	// append groups that were only in ps2
-	for title, panels := range mergedGroups {
-		if slices.Contains(onlyPs2, title) {
-			header := rowsPs2[title]
-			tmp1 = append(tmp1, header)
-			tmp1 = append(tmp1, panels...)
-			seen[title] = true
+		if _, ok := rowsPs1[title]; ok {
+			anchor = title
+			continue
+		}
+		group := append([]Panel{header}, mergedGroups[title]...)
+		if placement == AppendAfterMatching {
+			after[anchor] = append(after[anchor], group...)
+		} else {
+			tmp1 = append(tmp1, group...)
 		}
+		seen[title] = true
 	}
 
 	// preserve order of row headers from ps1
-	for _, p := range ps1 {
-		if t := p.TypeRaw(); t != nil {
-			var panelType string
-			if err := json.Unmarshal(t, &panelType); err != nil {
-				continue
-			}
-
-			if panelType == "row" {
-				var title string
-				if tr := p.TitleRaw(); tr != nil {
-					_ = json.Unmarshal(tr, &title)
-				} else {
-					title = "none"
-				}
-
-				// append header (prefer ps1 header)
-				if header, ok := rowsPs1[title]; ok {
-					tmp2 = append(tmp2, header)
-				} else if header, ok := rowsPs2[title]; ok {
-					tmp2 = append(tmp2, header)
-				} else {
-					tmp2 = append(tmp2, p)
-				}
-
-				if !seen[title] {
-					if panels, ok := mergedGroups[title]; ok {
-						tmp2 = append(tmp2, panels...)
-					}
-					seen[title] = true
-				}
-			}
+	tmp2 = append(tmp2, after[""]...)
+	for _, name := range namesPs1 {
+		header, ok := rowsPs1[name]
+		if !ok {
+			continue
+		}
+		tmp2 = append(tmp2, header)
+		if !seen[name] {
+			tmp2 = append(tmp2, mergedGroups[name]...)
+			seen[name] = true
 		}
+		tmp2 = append(tmp2, after[name]...)
 	}
 
 	res := make([]Panel, 0, len(mergedGroups["none"])+len(tmp1)+len(tmp2))
 
-	// ungrouped panels will always be appended to the top
+	// ungrouped panels are appended to the top, unless they keep their position
+	// right before the rows of ps1
 	// if top is true append the new panels and groups to the top
 	// otherwise to the bottom
-	res = append(res, mergedGroups["none"]...)
-	if top {
+	if !o.keepUngroupedPosition {
+		res = append(res, mergedGroups["none"]...)
+	}
+	if placement == AppendTop {
 		res = append(res, tmp1...)
-		res = append(res, tmp2...)
-	} else {
-		res = append(res, tmp2...)
+	}
+	if o.keepUngroupedPosition {
+		res = append(res, mergedGroups["none"]...)
+	}
+	res = append(res, tmp2...)
+	if placement == AppendBottom {
 		res = append(res, tmp1...)
 	}
 
 	// make the grid positions consistent
-	const maxWidth = 24
-	currentY := 0
-	currentRowWidth := 0
-	currentRowMaxBottom := 0 // Track tallest panel in row for next Y
-
-	for i := range res {
-		panel := res[i]
-		pos := panel.GridPos()
-		if currentRowWidth+pos.W > maxWidth {
-			// New row
-			currentY += currentRowMaxBottom
-			currentRowWidth = 0
-			currentRowMaxBottom = 0
-		}
-		// Place at next X in row
-		pos.X = currentRowWidth
-		pos.Y = currentY
-		posRaw, err := json.Marshal(pos)
-		if err != nil {
-			panic(err)
+	if !o.noRelayout {
+		if err := layOut(res, o); err != nil {
+			return nil, err
 		}
-		panel["gridPos"] = posRaw
-		res[i] = panel
-		// Update row tracking
-		currentRowWidth += pos.W
-		if pos.H > currentRowMaxBottom {
-			currentRowMaxBottom = pos.H
+	}
+
+	return renestCollapsedRows(res)
+}
+
+// GroupByRow groups the panels by the title of the row they belong to,
+// including the panels embedded in collapsed rows.
+// Panels that do not belong to any row are grouped under "none".
+// Rows with the same title are told apart by position, the second row titled
+// "Overview" is grouped under "Overview\x002" and so on.
+// It also returns the rows in document order, including the rows nested in collapsed rows.
+// The input panels are not modified.
+func GroupByRow(ps []Panel) (groups map[string][]Panel, rows []Panel) {
+	groups, _, _ = groupByRow(ps, false)
+	for _, p := range liftEmbeddedPanels(ps) {
+		if p.isRow() {
+			rows = append(rows, p.Clone())
 		}
 	}
-	return res
+	return groups, rows
 }
 
-func groupByRow(ps []Panel) (map[string][]Panel, map[string]Panel) {
+// groupByRow groups the panels by the title of the row they belong to.
+// Panels that do not belong to any row are grouped under "none".
+// Rows with the same title are told apart by position, the second row titled
+// "Overview" is grouped under "Overview\x002" and so on.
+// It also returns the group names in order of first appearance.
+//
+// The panels embedded in rows are moved to the group, if expand is true
+// the rows are also marked as not collapsed.
+// Rows nested in rows, at any depth, are lifted to the top level since Grafana
+// does not support nested rows, so no panel is dropped.
+func groupByRow(ps []Panel, expand bool) (map[string][]Panel, map[string]Panel, []string) {
 	groups := make(map[string][]Panel)
 	rows := make(map[string]Panel)
-	var groupName string = "none"
+	var names []string
+	grouper := newRowGrouper()
 
-	for _, p := range ps {
-		if t := p.TypeRaw(); t != nil {
-			var panelType string
-			if err := json.Unmarshal(t, &panelType); err != nil {
-				continue
+	for _, p := range liftEmbeddedPanels(ps) {
+		p = p.Clone()
+		groupName := grouper.group(p)
+
+		if p.isRow() {
+			if _, ok := groups[groupName]; !ok {
+				names = append(names, groupName)
+				groups[groupName] = nil
+			}
+			p["panels"], _ = json.Marshal([]Panel{})
+			if expand {
+				_ = p.SetCollapsed(false)
 			}
+			rows[groupName] = p
+		} else {
+			if _, ok := groups[groupName]; !ok {
+				names = append(names, groupName)
+			}
+			groups[groupName] = append(groups[groupName], p)
+		}
+	}
 
-			if panelType == "row" {
-				if tr := p.TitleRaw(); tr != nil {
-					var title string
-					if err := json.Unmarshal(tr, &title); err == nil {
-						groupName = title
-					}
-				}
-				groups[groupName] = append(groups[groupName], retrieveEmbeddedPanels(p)...)
-				p["panels"], _ = json.Marshal([]Panel{})
-				p["collapsed"], _ = json.Marshal(false)
-				rows[groupName] = p
-			} else {
-				groups[groupName] = append(groups[groupName], p)
+	return groups, rows, names
+}
+
+// rowGroups returns the name of the row group of every panel, as in groupByRow.
+// Panels embedded in collapsed rows are not considered.
+func rowGroups(ps []Panel) []string {
+	grouper := newRowGrouper()
+	res := make([]string, len(ps))
+	for i, p := range ps {
+		res[i] = grouper.group(p)
+	}
+	return res
+}
+
+// rowGrouper names the row groups of a sequence of panels.
+type rowGrouper struct {
+	name  string
+	count map[string]int
+}
+
+func newRowGrouper() *rowGrouper {
+	return &rowGrouper{
+		name:  "none",
+		count: map[string]int{"none": 1},
+	}
+}
+
+// group returns the name of the group of the next panel in the sequence.
+// Panels that do not belong to any row are grouped under "none", rows start a new group.
+func (g *rowGrouper) group(p Panel) string {
+	if p.isRow() {
+		title, _ := p.Title()
+		g.count[title]++
+		g.name = title
+		// the NUL separator cannot clash with a row actually titled "Overview#2"
+		if n := g.count[title]; n > 1 {
+			g.name = title + "\x00" + strconv.Itoa(n)
+		}
+	}
+	return g.name
+}
+
+// Collapsed returns the collapsed flag of a row panel and whether it is present.
+func (p Panel) Collapsed() (bool, bool) {
+	raw, ok := p["collapsed"]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return false, false
+	}
+	var collapsed bool
+	if err := json.Unmarshal(raw, &collapsed); err != nil {
+		return false, false
+	}
+	return collapsed, true
+}
+
+// SetCollapsed sets the collapsed flag of a row panel.
+func (p Panel) SetCollapsed(collapsed bool) error {
+	return p.setField("collapsed", collapsed)
+}
+
+func (p Panel) collapsed() bool {
+	collapsed, _ := p.Collapsed()
+	return collapsed
+}
+
+func (p Panel) isRow() bool {
+	t, ok := p.Type()
+	return ok && t == "row"
+}
+
+// RenestCollapsedRows moves the panels following a collapsed row, up to the next row,
+// into the row's panels field, as expected by Grafana.
+// Panels already embedded in the row are kept before the moved panels.
+// The input panels are not modified.
+func RenestCollapsedRows(ps []Panel) []Panel {
+	res, err := renestCollapsedRows(ps)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func renestCollapsedRows(ps []Panel) ([]Panel, error) {
+	res := make([]Panel, 0, len(ps))
+
+	var (
+		row      Panel
+		children []Panel
+	)
+	flush := func() error {
+		if row == nil {
+			return nil
+		}
+		raw, err := json.Marshal(children)
+		if err != nil {
+			return newMergeError(row, "panels", fmt.Errorf("marshal panels: %w", err))
+		}
+		row["panels"] = raw
+		row = nil
+		return nil
+	}
+
+	for _, p := range ps {
+		if p.isRow() {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if p.collapsed() {
+				p = p.Clone()
+				row, children = p, retrieveEmbeddedPanels(p)
 			}
+			res = append(res, p)
+			continue
 		}
+
+		if row != nil {
+			children = append(children, p)
+		} else {
+			res = append(res, p)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
 	}
 
-	return groups, rows
+	return res, nil
+}
+
+// liftEmbeddedPanels returns the panels with the panels embedded in rows
+// placed right after their row, recursively.
+func liftEmbeddedPanels(ps []Panel) []Panel {
+	res := make([]Panel, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, p)
+		if p.isRow() {
+			res = append(res, liftEmbeddedPanels(retrieveEmbeddedPanels(p))...)
+		}
+	}
+	return res
 }
 
 func retrieveEmbeddedPanels(p Panel) []Panel {
@@ -4,6 +4,7 @@ package dashboardfusion
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -104,6 +105,91 @@ func TestMergePanels(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "replace first match only",
+			base: []Panel{
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"gridPos": json.RawMessage(`{"x":0,"y":0,"h":2,"w":6}`),
+					"id":      json.RawMessage("1"),
+				},
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"gridPos": json.RawMessage(`{"x":6,"y":0,"h":2,"w":6}`),
+					"id":      json.RawMessage("2"),
+				},
+			},
+			extra: []Panel{
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"content": json.RawMessage("Wanted Content for Panel1"),
+					"id":      json.RawMessage("3"),
+				},
+			},
+			wanted: []Panel{
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"content": json.RawMessage("Wanted Content for Panel1"),
+					"gridPos": json.RawMessage(`{"x":0,"y":0,"h":2,"w":6}`),
+					"id":      json.RawMessage("1"),
+				},
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"gridPos": json.RawMessage(`{"x":6,"y":0,"h":2,"w":6}`),
+					"id":      json.RawMessage("2"),
+				},
+			},
+		},
+		{
+			name: "append keeps panel size",
+			base: []Panel{
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"gridPos": json.RawMessage(`{"x":0,"y":0,"h":3,"w":5}`),
+					"id":      json.RawMessage("1"),
+				},
+			},
+			extra: []Panel{
+				{
+					"title":   json.RawMessage("Table"),
+					"type":    json.RawMessage("table"),
+					"gridPos": json.RawMessage(`{"x":4,"y":40,"h":8,"w":24}`),
+					"id":      json.RawMessage("1"),
+				},
+				{
+					"title":   json.RawMessage("Stat"),
+					"type":    json.RawMessage("stat"),
+					"gridPos": json.RawMessage(`{"x":4,"y":40,"w":4}`),
+					"id":      json.RawMessage("1"),
+				},
+			},
+			wanted: []Panel{
+				{
+					"title":   json.RawMessage("Panel1"),
+					"type":    json.RawMessage("graph"),
+					"gridPos": json.RawMessage(`{"x":0,"y":0,"h":3,"w":5}`),
+					"id":      json.RawMessage("1"),
+				},
+				{
+					"title":   json.RawMessage("Table"),
+					"type":    json.RawMessage("table"),
+					"gridPos": json.RawMessage(`{"h":8,"w":24,"x":0,"y":4}`),
+					"id":      json.RawMessage("2"),
+				},
+				{
+					"title":   json.RawMessage("Stat"),
+					"type":    json.RawMessage("stat"),
+					"gridPos": json.RawMessage(`{"h":2,"w":4,"x":0,"y":13}`),
+					"id":      json.RawMessage("3"),
+				},
+			},
+		},
 	}
 
 	for i := range tests {
@@ -117,3 +203,1709 @@ func TestMergePanels(t *testing.T) {
 		})
 	}
 }
+
+func TestEquals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		p1, p2 Panel
+		wanted bool
+	}{
+		{
+			name:   "same title and type",
+			p1:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`)},
+			wanted: true,
+		},
+		{
+			name:   "different type",
+			p1:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"stat"`)},
+			wanted: false,
+		},
+		{
+			name:   "missing and null type",
+			p1:     Panel{"title": json.RawMessage(`"A"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`null`)},
+			wanted: true,
+		},
+		{
+			name:   "missing and present type",
+			p1:     Panel{"title": json.RawMessage(`"A"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`)},
+			wanted: false,
+		},
+		{
+			name:   "repeated by the same variable",
+			p1:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`"host"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`"host"`)},
+			wanted: true,
+		},
+		{
+			name:   "repeated and static",
+			p1:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`"host"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`""`)},
+			wanted: false,
+		},
+		{
+			name:   "repeated by different variables",
+			p1:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`"host"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "repeat": json.RawMessage(`"pod"`)},
+			wanted: false,
+		},
+		{
+			name:   "missing titles and same content",
+			p1:     Panel{"type": json.RawMessage(`"text"`), "options": json.RawMessage(`{"content":"A"}`), "id": json.RawMessage(`1`)},
+			p2:     Panel{"type": json.RawMessage(`"text"`), "options": json.RawMessage(`{ "content": "A" }`), "id": json.RawMessage(`2`)},
+			wanted: true,
+		},
+		{
+			name:   "missing titles and different content",
+			p1:     Panel{"type": json.RawMessage(`"text"`), "options": json.RawMessage(`{"content":"A"}`)},
+			p2:     Panel{"type": json.RawMessage(`"text"`), "options": json.RawMessage(`{"content":"B"}`)},
+			wanted: false,
+		},
+		{
+			name:   "missing and present title",
+			p1:     Panel{"type": json.RawMessage(`"graph"`)},
+			p2:     Panel{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`)},
+			wanted: false,
+		},
+		{
+			name:   "null and empty titles",
+			p1:     Panel{"title": json.RawMessage(`null`), "type": json.RawMessage(`"graph"`)},
+			p2:     Panel{"title": json.RawMessage(`""`), "type": json.RawMessage(`"graph"`)},
+			wanted: false,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.p1.Equals(tc.p2); got != tc.wanted {
+				t.Fatalf("expected %v, got %v", tc.wanted, got)
+			}
+			k1, ok1 := equalsKey(tc.p1)
+			k2, ok2 := equalsKey(tc.p2)
+			if got := ok1 && ok2 && k1 == k2; got != tc.wanted {
+				t.Fatalf("expected match key equality %v, got %v", tc.wanted, got)
+			}
+		})
+	}
+}
+
+func TestMergePanelsDoesNotModifyInputs(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{
+			"title":   json.RawMessage(`"Panel1"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"x":0,"y":0,"h":2,"w":6}`),
+			"id":      json.RawMessage("1"),
+		},
+	}
+	extra := []Panel{
+		{
+			"title": json.RawMessage(`"Panel1"`),
+			"type":  json.RawMessage(`"graph"`),
+			"id":    json.RawMessage("5"),
+		},
+		{
+			"title": json.RawMessage(`"Panel2"`),
+			"type":  json.RawMessage(`"graph"`),
+			"id":    json.RawMessage("6"),
+		},
+	}
+	wantBase, wantExtra := clonePanels(base), clonePanels(extra)
+
+	MergePanels(base, extra)
+	MergePanelsByGroup(base, extra, false)
+
+	if diff := cmp.Diff(wantBase, base); diff != "" {
+		t.Errorf("base modified (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantExtra, extra); diff != "" {
+		t.Errorf("extra modified (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergeManyPanels(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, content string) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"content": json.RawMessage(`"` + content + `"`),
+		}
+	}
+
+	first := []Panel{panel("A", "first")}
+	second := []Panel{panel("A", "second"), panel("B", "second")}
+	third := []Panel{panel("B", "third"), panel("C", "third")}
+	wantFirst := clonePanels(first)
+
+	type result struct {
+		Title   string
+		Content string
+	}
+	var got []result
+	for _, p := range MergeManyPanels(first, second, third) {
+		title, _ := p.Title()
+		var content string
+		if err := json.Unmarshal(p["content"], &content); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, result{title, content})
+	}
+	want := []result{
+		{"A", "second"},
+		{"B", "third"},
+		{"C", "third"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantFirst, first); diff != "" {
+		t.Errorf("first set modified (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(MergePanels(first, second), MergeManyPanels(first, second)); diff != "" {
+		t.Errorf("unexpected result for two sets (-want +got):\n%s", diff)
+	}
+	if got := MergeManyPanels(); got != nil {
+		t.Errorf("expected nil for no sets, got %v", got)
+	}
+}
+
+func TestMergePanelsByGroupOrder(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Row A"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)},
+	}
+	var extra []Panel
+	for _, title := range []string{"Row B", "Row C", "Row D", "Row E"} {
+		extra = append(extra,
+			Panel{"title": json.RawMessage(`"` + title + `"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)},
+			Panel{"title": json.RawMessage(`"` + title + ` panel"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":1}`)},
+		)
+	}
+
+	want := []string{"Row A", "Row B", "Row B panel", "Row C", "Row C panel", "Row D", "Row D panel", "Row E", "Row E panel"}
+	for i := 0; i < 10; i++ {
+		var got []string
+		for _, p := range MergePanelsByGroup(base, extra, false) {
+			title, _ := p.Title()
+			got = append(got, title)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected order (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestMergePanelsByGroupCollapsedRows(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{
+			"title":     json.RawMessage(`"Row A"`),
+			"type":      json.RawMessage(`"row"`),
+			"collapsed": json.RawMessage(`true`),
+			"gridPos":   json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`),
+			"panels":    json.RawMessage(`[{"title":"Panel1","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":1},"id":1}]`),
+		},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Row A"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":1}`)},
+	}
+
+	t.Run("preserve", func(t *testing.T) {
+		t.Parallel()
+		res := MergePanelsByGroup(base, extra, false)
+		if len(res) != 1 {
+			t.Fatalf("expected only the row at top level, got %d panels", len(res))
+		}
+		if !res[0].collapsed() {
+			t.Fatal("expected row to stay collapsed")
+		}
+		if got := len(retrieveEmbeddedPanels(res[0])); got != 2 {
+			t.Fatalf("expected 2 embedded panels, got %d", got)
+		}
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		t.Parallel()
+		res := MergePanelsByGroup(base, extra, false, WithExpandRows(true))
+		if len(res) != 3 {
+			t.Fatalf("expected 3 panels at top level, got %d", len(res))
+		}
+		if res[0].collapsed() {
+			t.Fatal("expected row to be expanded")
+		}
+	})
+}
+
+func TestRenestCollapsedRows(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Row A"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`true`), "panels": json.RawMessage(`[]`)},
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Row B"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`false`)},
+		{"title": json.RawMessage(`"Panel3"`), "type": json.RawMessage(`"graph"`)},
+	}
+
+	wanted := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Row A"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`true`), "panels": json.RawMessage(`[{"title":"Panel2","type":"graph"}]`)},
+		{"title": json.RawMessage(`"Row B"`), "type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`false`)},
+		{"title": json.RawMessage(`"Panel3"`), "type": json.RawMessage(`"graph"`)},
+	}
+	if diff := cmp.Diff(wanted, RenestCollapsedRows(ps)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsAppendMultiple(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":3,"w":6,"x":0,"y":0}`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"Panel3"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Panel4"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":5,"w":6,"x":0,"y":0}`)},
+	}
+
+	merged := MergePanels(base, extra)
+	if len(merged) != 4 {
+		t.Fatalf("expected 4 panels, got %d", len(merged))
+	}
+	if overlaps := OverlappingPanels(merged); len(overlaps) != 0 {
+		t.Fatalf("unexpected overlapping panels %v", overlaps)
+	}
+	for i := 1; i < len(merged); i++ {
+		prev, cur := merged[i-1].GridPos(), merged[i].GridPos()
+		if cur.Y < prev.Y+prev.H {
+			t.Errorf("panel %d starts at Y %d, before the end of panel %d at Y %d", i, cur.Y, i-1, prev.Y+prev.H)
+		}
+	}
+}
+
+func TestMergePanelsEmptyBase(t *testing.T) {
+	t.Parallel()
+
+	extra := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":8,"w":12,"x":0,"y":0}`), "id": json.RawMessage(`4`)},
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":8,"w":12,"x":12,"y":0}`), "id": json.RawMessage(`5`)},
+	}
+
+	for _, base := range [][]Panel{nil, {}} {
+		merged := MergePanels(base, extra)
+		if diff := cmp.Diff(extra, merged); diff != "" {
+			t.Fatalf("unexpected result (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestMergePanelsAfterCollapsedRow(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":3,"w":6,"x":0,"y":0}`)},
+		{
+			"title":     json.RawMessage(`"Row"`),
+			"type":      json.RawMessage(`"row"`),
+			"collapsed": json.RawMessage(`true`),
+			"gridPos":   json.RawMessage(`{"h":1,"w":24,"x":0,"y":3}`),
+			"panels":    json.RawMessage(`[{"title":"Nested","type":"graph","gridPos":{"h":8,"w":12,"x":0,"y":4}}]`),
+		},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":6,"x":0,"y":0}`)},
+	}
+
+	merged := MergePanels(base, extra)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 panels, got %d", len(merged))
+	}
+	if y := merged[2].GridPos().Y; y < 12 {
+		t.Fatalf("expected appended panel below the collapsed row content at Y 12, got Y %d", y)
+	}
+}
+
+func TestMergePanelsNestedMaxID(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`)},
+		{
+			"title":     json.RawMessage(`"Row"`),
+			"type":      json.RawMessage(`"row"`),
+			"id":        json.RawMessage(`2`),
+			"collapsed": json.RawMessage(`true`),
+			"panels":    json.RawMessage(`[{"title":"Nested","type":"graph","id":10}]`),
+		},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`)},
+	}
+
+	merged := MergePanels(base, extra)
+	if id, _ := merged[2].ID(); id != 11 {
+		t.Fatalf("expected appended panel to get id 11, got %d", id)
+	}
+
+	merged = MergePanelsByGroup(base, extra, false)
+	d := Dashboard{}
+	if err := setField(d, "panels", merged); err != nil {
+		t.Fatal(err)
+	}
+	if dups, err := d.DuplicateIDs(); err != nil || len(dups) != 0 {
+		t.Fatalf("unexpected duplicate ids %v, %v", dups, err)
+	}
+}
+
+func TestMergePanelsOptions(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{
+			"title":       json.RawMessage(`"Panel1"`),
+			"type":        json.RawMessage(`"graph"`),
+			"description": json.RawMessage(`"old description"`),
+			"targets":     json.RawMessage(`[{"expr":"old"}]`),
+			"options":     json.RawMessage(`{"legend":false}`),
+			"gridPos":     json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"id":          json.RawMessage(`1`),
+		},
+	}
+	extra := []Panel{
+		{
+			"title":       json.RawMessage(`"Panel1"`),
+			"type":        json.RawMessage(`"graph"`),
+			"description": json.RawMessage(`"new description"`),
+			"targets":     json.RawMessage(`[{"expr":"new"}]`),
+			"options":     json.RawMessage(`{"legend":true}`),
+			"links":       json.RawMessage(`[]`),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted Panel
+	}{
+		{
+			name: "keep targets",
+			opts: []Option{WithKeepTargets()},
+			wanted: Panel{
+				"title":       json.RawMessage(`"Panel1"`),
+				"type":        json.RawMessage(`"graph"`),
+				"description": json.RawMessage(`"new description"`),
+				"targets":     json.RawMessage(`[{"expr":"old"}]`),
+				"options":     json.RawMessage(`{"legend":true}`),
+				"links":       json.RawMessage(`[]`),
+				"gridPos":     json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+				"id":          json.RawMessage(`1`),
+			},
+		},
+		{
+			name: "preserve fields",
+			opts: []Option{WithPreserveFields("description", "links")},
+			wanted: Panel{
+				"title":       json.RawMessage(`"Panel1"`),
+				"type":        json.RawMessage(`"graph"`),
+				"description": json.RawMessage(`"old description"`),
+				"targets":     json.RawMessage(`[{"expr":"new"}]`),
+				"options":     json.RawMessage(`{"legend":true}`),
+				"links":       json.RawMessage(`[]`),
+				"gridPos":     json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+				"id":          json.RawMessage(`1`),
+			},
+		},
+		{
+			name: "preserve description",
+			opts: []Option{WithPreserveDescription()},
+			wanted: Panel{
+				"title":       json.RawMessage(`"Panel1"`),
+				"type":        json.RawMessage(`"graph"`),
+				"description": json.RawMessage(`"old description"`),
+				"targets":     json.RawMessage(`[{"expr":"new"}]`),
+				"options":     json.RawMessage(`{"legend":true}`),
+				"links":       json.RawMessage(`[]`),
+				"gridPos":     json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+				"id":          json.RawMessage(`1`),
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			merged := MergePanels(base, extra, tc.opts...)
+			if diff := cmp.Diff([]Panel{tc.wanted}, merged); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsPreserveLibraryPanels(t *testing.T) {
+	t.Parallel()
+
+	ref := json.RawMessage(`{"name":"CPU","uid":"lib1"}`)
+	base := []Panel{
+		{"title": json.RawMessage(`"CPU"`), "type": json.RawMessage(`"timeseries"`), "libraryPanel": ref},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"CPU"`), "type": json.RawMessage(`"timeseries"`), "options": json.RawMessage(`{}`)},
+	}
+
+	merged := MergePanels(base, extra)
+	if _, ok := merged[0].LibraryPanel(); ok {
+		t.Fatal("expected library panel reference to be overwritten by default")
+	}
+
+	merged = MergePanels(base, extra, WithPreserveLibraryPanels())
+	got, ok := merged[0].LibraryPanel()
+	if !ok {
+		t.Fatal("expected library panel reference to be preserved")
+	}
+	if diff := cmp.Diff(string(ref), string(got)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsTitlePrefix(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Latency"`), "type": json.RawMessage(`"graph"`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Latency"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Errors"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Errors"`), "type": json.RawMessage(`"graph"`)},
+		{"type": json.RawMessage(`"text"`)},
+	}
+
+	var got []string
+	for _, p := range MergePanels(base, extra, WithTitlePrefix("[team-a] ")) {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"Latency", "[team-a] Errors", ""}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if title, _ := extra[1].Title(); title != "Errors" {
+		t.Fatalf("expected input panel not to be modified, got title %q", title)
+	}
+}
+
+func TestMergePanelsMatchWithinRow(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, typ, expr string) Panel {
+		p := Panel{
+			"title": json.RawMessage(`"` + title + `"`),
+			"type":  json.RawMessage(`"` + typ + `"`),
+		}
+		if expr != "" {
+			p["targets"] = json.RawMessage(`[{"expr":"` + expr + `"}]`)
+		}
+		return p
+	}
+
+	base := []Panel{
+		panel("Frontend", "row", ""),
+		panel("CPU", "graph", "frontend"),
+		panel("Backend", "row", ""),
+		panel("Memory", "graph", "backend"),
+	}
+	extra := []Panel{
+		panel("Backend", "row", ""),
+		panel("CPU", "graph", "backend"),
+	}
+
+	for _, opts := range [][]Option{{WithMatchWithinRow()}, {WithMatchWithinRow(), WithMatcher(Panel.Equals)}} {
+		merged := MergePanels(base, extra, opts...)
+		if len(merged) != 5 {
+			t.Fatalf("expected 5 panels, got %d", len(merged))
+		}
+		if diff := cmp.Diff(string(base[1]["targets"]), string(merged[1]["targets"])); diff != "" {
+			t.Fatalf("expected panel of another row not to be overwritten (-want +got):\n%s", diff)
+		}
+	}
+
+	if merged := MergePanels(base, extra); len(merged) != 4 {
+		t.Fatalf("expected panels to match across rows by default, got %d panels", len(merged))
+	}
+}
+
+func TestMergePanelsByGroupIdempotent(t *testing.T) {
+	t.Parallel()
+
+	raw := `[
+		{"id":1,"title":"Overview","type":"stat","gridPos":{"h":4,"w":12,"x":0,"y":0}},
+		{"id":2,"title":"Errors","type":"timeseries","gridPos":{"h":8,"w":12,"x":12,"y":0},"targets":[{"expr":"errors"}]},
+		{"id":3,"title":"Latency","type":"timeseries","gridPos":{"h":4,"w":12,"x":0,"y":4}},
+		{"id":4,"title":"Backend","type":"row","collapsed":false,"gridPos":{"h":1,"w":24,"x":0,"y":8},"panels":[]},
+		{"id":5,"title":"CPU","type":"timeseries","gridPos":{"h":8,"w":8,"x":0,"y":9}},
+		{"id":6,"title":"Memory","type":"timeseries","gridPos":{"h":8,"w":16,"x":8,"y":9}},
+		{"id":7,"title":"Database","type":"row","collapsed":true,"gridPos":{"h":1,"w":24,"x":0,"y":17},"panels":[
+			{"id":8,"title":"Queries","type":"timeseries","gridPos":{"h":8,"w":24,"x":0,"y":18}}
+		]},
+		{"id":9,"title":"Network","type":"row","collapsed":false,"gridPos":{"h":1,"w":24,"x":0,"y":18},"panels":[]},
+		{"id":10,"title":"Traffic","type":"timeseries","gridPos":{"h":6,"w":24,"x":0,"y":19}},
+		{"id":11,"type":"text","options":{"content":"Notes"},"gridPos":{"h":4,"w":24,"x":0,"y":25}}
+	]`
+	var ps []Panel
+	if err := json.Unmarshal([]byte(raw), &ps); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := marshalCanonical(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := marshalCanonical(MergePanelsByGroup(ps, ps, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsPreserveTransformations(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"CPU"`), "type": json.RawMessage(`"table"`), "transformations": json.RawMessage(`[{"id":"organize"},{"id":"merge"}]`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"CPU"`), "type": json.RawMessage(`"table"`), "transformations": json.RawMessage(`[{"id":"reduce"}]`)},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted []string
+	}{
+		{name: "default", wanted: []string{`{"id":"reduce"}`}},
+		{name: "preserve", opts: []Option{WithPreserveTransformations()}, wanted: []string{`{"id":"organize"}`, `{"id":"merge"}`}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ts, ok := MergePanels(base, extra, tc.opts...)[0].Transformations()
+			if !ok {
+				t.Fatal("expected transformations")
+			}
+			var got []string
+			for _, tr := range ts {
+				got = append(got, string(tr))
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsSortAppended(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, typ string, h int) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"` + typ + `"`),
+			"gridPos": json.RawMessage(fmt.Sprintf(`{"h":%d,"w":6,"x":0,"y":0}`, h)),
+		}
+	}
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Base"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`), "id": json.RawMessage(`1`)},
+	}
+	extra := []Panel{
+		panel("Zeta", "graph", 3),
+		panel("Alpha", "graph", 1),
+		panel("Row", "row", 1),
+		panel("Gamma", "graph", 2),
+		panel("Beta", "graph", 2),
+	}
+
+	type result struct {
+		Title string
+		ID    int
+		Y     int
+	}
+	var got []result
+	for _, p := range MergePanels(base, extra, WithSortAppended()) {
+		title, _ := p.Title()
+		id, _ := p.ID()
+		got = append(got, result{title, id, p.GridPos().Y})
+	}
+	want := []result{
+		{"Base", 1, 0},
+		{"Alpha", 2, 3},
+		{"Zeta", 3, 5},
+		{"Row", 4, 9},
+		{"Beta", 5, 11},
+		{"Gamma", 6, 14},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsAppendGap(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Base"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":3,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want []int
+	}{
+		{
+			name: "default",
+			want: []int{0, 3, 7},
+		},
+		{
+			name: "flush",
+			opts: []Option{WithAppendGap(0)},
+			want: []int{0, 2, 5},
+		},
+		{
+			name: "negative",
+			opts: []Option{WithAppendGap(-3)},
+			want: []int{0, 2, 5},
+		},
+		{
+			name: "sorted",
+			opts: []Option{WithAppendGap(2), WithSortAppended()},
+			want: []int{0, 4, 9},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []int
+			for _, p := range MergePanels(base, extra, tc.opts...) {
+				got = append(got, p.GridPos().Y)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsMergeLinks(t *testing.T) {
+	t.Parallel()
+
+	panel := func(links string) Panel {
+		p := Panel{
+			"title":   json.RawMessage(`"Panel1"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"id":      json.RawMessage(`1`),
+		}
+		if links != "" {
+			p["links"] = json.RawMessage(links)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		l1, l2 string
+		wanted string
+	}{
+		{
+			name:   "union",
+			l1:     `[{"title":"Docs","url":"https://a"},{"title":"Runbook","url":"https://b"}]`,
+			l2:     `[{"title":"Runbook","url":"https://b","targetBlank":true},{"title":"Docs","url":"https://c"},{"title":"New","url":"https://d"}]`,
+			wanted: `[{"title":"Docs","url":"https://a"},{"title":"Runbook","url":"https://b"},{"title":"Docs","url":"https://c"},{"title":"New","url":"https://d"}]`,
+		},
+		{
+			name:   "duplicates in ps2",
+			l1:     `[]`,
+			l2:     `[{"title":"Docs","url":"https://a"},{"title":"Docs","url":"https://a"}]`,
+			wanted: `[{"title":"Docs","url":"https://a"}]`,
+		},
+		{
+			name:   "tag links",
+			l1:     `[{"type":"dashboards","tags":["a"]},{"type":"dashboards","tags":["b"]}]`,
+			l2:     `[{"tags":["b"],"type":"dashboards"},{"type":"dashboards","tags":["c"]}]`,
+			wanted: `[{"type":"dashboards","tags":["a"]},{"type":"dashboards","tags":["b"]},{"type":"dashboards","tags":["c"]}]`,
+		},
+		{
+			name:   "only in ps1",
+			l1:     `[{"title":"Docs","url":"https://a"}]`,
+			wanted: `[{"title":"Docs","url":"https://a"}]`,
+		},
+		{
+			name: "no links",
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			merged := MergePanels([]Panel{panel(tc.l1)}, []Panel{panel(tc.l2)}, WithMergeLinks())
+			if diff := cmp.Diff([]Panel{panel(tc.wanted)}, merged); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsPreferNewLayout(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{
+			"title":   json.RawMessage(`"Panel1"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`),
+			"id":      json.RawMessage(`1`),
+		},
+		{
+			"title":   json.RawMessage(`"Panel2"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"h":2,"w":6,"x":6,"y":0}`),
+			"id":      json.RawMessage(`2`),
+		},
+	}
+	extra := []Panel{
+		{
+			"title":   json.RawMessage(`"Panel1"`),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(`{"h":8,"w":12,"x":12,"y":0}`),
+			"id":      json.RawMessage(`7`),
+		},
+		{
+			"title": json.RawMessage(`"Panel2"`),
+			"type":  json.RawMessage(`"graph"`),
+			"id":    json.RawMessage(`8`),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted []Panel
+	}{
+		{
+			name:   "default",
+			wanted: base,
+		},
+		{
+			name: "prefer new layout",
+			opts: []Option{WithPreferNewLayout()},
+			wanted: []Panel{
+				{
+					"title":   json.RawMessage(`"Panel1"`),
+					"type":    json.RawMessage(`"graph"`),
+					"gridPos": json.RawMessage(`{"h":8,"w":12,"x":12,"y":0}`),
+					"id":      json.RawMessage(`1`),
+				},
+				// without a gridPos in ps2 the position in ps1 is kept
+				base[1],
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			merged := MergePanels(base, extra, tc.opts...)
+			if diff := cmp.Diff(tc.wanted, merged); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkMergePanels(b *testing.B) {
+	const n = 500
+
+	base := make([]Panel, 0, n)
+	extra := make([]Panel, 0, n)
+	for i := 0; i < n; i++ {
+		base = append(base, Panel{
+			"title":   json.RawMessage(fmt.Sprintf(`"Panel%d"`, i)),
+			"type":    json.RawMessage(`"graph"`),
+			"gridPos": json.RawMessage(fmt.Sprintf(`{"h":2,"w":6,"x":0,"y":%d}`, 2*i)),
+			"id":      json.RawMessage(fmt.Sprint(i)),
+		})
+		extra = append(extra, Panel{
+			"title": json.RawMessage(fmt.Sprintf(`"Panel%d"`, n-i)),
+			"type":  json.RawMessage(`"graph"`),
+		})
+	}
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MergePanels(base, extra)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MergePanels(base, extra, WithMatcher(Panel.Equals))
+		}
+	})
+}
+
+func TestMergePanelsByGroupIDs(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"R"`), "type": json.RawMessage(`"row"`), "id": json.RawMessage(`2`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"R"`), "type": json.RawMessage(`"row"`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"S"`), "type": json.RawMessage(`"row"`), "id": json.RawMessage(`2`)},
+		{"title": json.RawMessage(`"C"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`)},
+	}
+
+	type result struct {
+		Title string
+		ID    int
+	}
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted []result
+	}{
+		{
+			name:   "new ids",
+			wanted: []result{{"A", 1}, {"R", 2}, {"B", 3}, {"S", 4}, {"C", 5}},
+		},
+		{
+			name:   "preserve ids",
+			opts:   []Option{WithPreserveIDs(true)},
+			wanted: []result{{"A", 1}, {"R", 2}, {"B", 1}, {"S", 2}, {"C", 1}},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got []result
+			for _, p := range MergePanelsByGroup(base, extra, false, tc.opts...) {
+				title, _ := p.Title()
+				id, _ := p.ID()
+				got = append(got, result{title, id})
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsByGroupDuplicateRowTitles(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, typ string) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"` + typ + `"`),
+			"gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`),
+		}
+	}
+
+	base := []Panel{
+		panel("Overview", "row"),
+		panel("CPU", "graph"),
+		panel("Overview", "row"),
+		panel("Memory", "graph"),
+	}
+	extra := []Panel{
+		panel("Overview", "row"),
+		panel("CPU", "graph"),
+		panel("Overview", "row"),
+		panel("Disk", "graph"),
+	}
+
+	var got []string
+	for _, p := range MergePanelsByGroup(base, extra, false) {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"Overview", "CPU", "Overview", "Memory", "Disk"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	groups, rows := GroupByRow(base)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if len(groups["Overview"]) != 1 || len(groups["Overview\x002"]) != 1 {
+		t.Fatalf("unexpected groups %v", groups)
+	}
+}
+
+func TestMergePanelsByGroupPlacement(t *testing.T) {
+	t.Parallel()
+
+	row := func(title string) Panel {
+		return Panel{"title": json.RawMessage(`"` + title + `"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)}
+	}
+	base := []Panel{row("A"), row("B")}
+	extra := []Panel{row("New1"), row("A"), row("New2"), row("B"), row("New3")}
+
+	tests := []struct {
+		name   string
+		opt    Option
+		wanted []string
+	}{
+		{name: "bottom", opt: WithPlacement(AppendBottom), wanted: []string{"A", "B", "New1", "New2", "New3"}},
+		{name: "top", opt: WithPlacement(AppendTop), wanted: []string{"New1", "New2", "New3", "A", "B"}},
+		{name: "after matching", opt: WithPlacement(AppendAfterMatching), wanted: []string{"New1", "A", "New2", "B", "New3"}},
+		{name: "with top", opt: WithTop(true), wanted: []string{"New1", "New2", "New3", "A", "B"}},
+		{name: "without top", opt: WithTop(false), wanted: []string{"A", "B", "New1", "New2", "New3"}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, p := range MergePanelsByGroup(base, extra, true, tc.opt) {
+				title, _ := p.Title()
+				got = append(got, title)
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsByGroupNestedRows(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{
+			"title":     json.RawMessage(`"A"`),
+			"type":      json.RawMessage(`"row"`),
+			"collapsed": json.RawMessage(`true`),
+			"gridPos":   json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`),
+			"panels": json.RawMessage(`[
+				{"title":"A1","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":1}},
+				{"title":"B","type":"row","collapsed":true,"gridPos":{"h":1,"w":24,"x":0,"y":3},"panels":[
+					{"title":"B1","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":4}}
+				]}
+			]`),
+		},
+	}
+
+	res := MergePanelsByGroup(ps, nil, false)
+
+	var got []string
+	for _, p := range res {
+		title, _ := p.Title()
+		for _, c := range retrieveEmbeddedPanels(p) {
+			ct, _ := c.Title()
+			title += "/" + ct
+		}
+		got = append(got, title)
+	}
+	want := []string{"A/A1", "B/B1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsWithResult(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"Panel2"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Panel3"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Panel3"`), "type": json.RawMessage(`"graph"`)},
+	}
+
+	res := MergePanelsWithResult(base, extra)
+	if len(res.Panels) != 3 {
+		t.Fatalf("expected 3 panels, got %d", len(res.Panels))
+	}
+	if diff := cmp.Diff([]int{1}, res.Updated); diff != "" {
+		t.Errorf("unexpected updated (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{2}, res.Appended); diff != "" {
+		t.Errorf("unexpected appended (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsByGroupKeepUngroupedPosition(t *testing.T) {
+	t.Parallel()
+
+	row := func(title string) Panel {
+		return Panel{"title": json.RawMessage(`"` + title + `"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)}
+	}
+	panel := func(title string) Panel {
+		return Panel{"title": json.RawMessage(`"` + title + `"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)}
+	}
+	base := []Panel{panel("Ungrouped"), row("A"), panel("A1")}
+	extra := []Panel{row("New"), panel("New1")}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted []string
+	}{
+		{name: "default", wanted: []string{"Ungrouped", "New", "New1", "A", "A1"}},
+		{name: "keep position", opts: []Option{WithKeepUngroupedPosition()}, wanted: []string{"New", "New1", "Ungrouped", "A", "A1"}},
+		{name: "append bottom", opts: []Option{WithKeepUngroupedPosition(), WithPlacement(AppendBottom)}, wanted: []string{"Ungrouped", "A", "A1", "New", "New1"}},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, p := range MergePanelsByGroup(base, extra, true, tc.opts...) {
+				title, _ := p.Title()
+				got = append(got, title)
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsByGroupNumberedRowTitle(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, typ string) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"` + typ + `"`),
+			"gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`),
+		}
+	}
+
+	base := []Panel{
+		panel("Overview", "row"),
+		panel("a", "graph"),
+		panel("Overview#2", "row"),
+		panel("b", "graph"),
+		panel("Overview", "row"),
+		panel("c", "graph"),
+	}
+	extra := []Panel{
+		panel("Overview#2", "row"),
+		panel("d", "graph"),
+	}
+
+	var got []string
+	for _, p := range MergePanelsByGroup(base, extra, false) {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"Overview", "a", "Overview#2", "b", "d", "Overview", "c"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	groups, rows := GroupByRow(base)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	for name, title := range map[string]string{"Overview": "a", "Overview#2": "b", "Overview\x002": "c"} {
+		if len(groups[name]) != 1 {
+			t.Fatalf("%q: unexpected groups %v", name, groups)
+		}
+		if got, _ := groups[name][0].Title(); got != title {
+			t.Errorf("%q: expected panel %q, got %q", name, title, got)
+		}
+	}
+}
+
+func TestGroupByRow(t *testing.T) {
+	t.Parallel()
+
+	raw := `[
+		{"title":"Top","type":"graph"},
+		{"title":"Outer","type":"row","collapsed":true,"panels":[
+			{"title":"A","type":"graph"},
+			{"title":"Inner","type":"row","collapsed":true,"panels":[{"title":"B","type":"graph"}]}
+		]},
+		{"title":"Last","type":"row","collapsed":false,"panels":[]},
+		{"title":"C","type":"graph"}
+	]`
+	var ps []Panel
+	if err := json.Unmarshal([]byte(raw), &ps); err != nil {
+		t.Fatal(err)
+	}
+	before := clonePanels(ps)
+
+	groups, rows := GroupByRow(ps)
+
+	got := make(map[string][]string)
+	for name, g := range groups {
+		for _, p := range g {
+			title, _ := p.Title()
+			got[name] = append(got[name], title)
+		}
+	}
+	want := map[string][]string{
+		"none":  {"Top"},
+		"Outer": {"A"},
+		"Inner": {"B"},
+		"Last":  {"C"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected groups (-want +got):\n%s", diff)
+	}
+	var titles []string
+	for _, r := range rows {
+		title, _ := r.Title()
+		titles = append(titles, title)
+	}
+	if diff := cmp.Diff([]string{"Outer", "Inner", "Last"}, titles); diff != "" {
+		t.Errorf("unexpected rows (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(before, ps); diff != "" {
+		t.Errorf("input modified (-want +got):\n%s", diff)
+	}
+}
+
+func TestPanelID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		raw  string
+		id   int
+		ok   bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "wrong type", raw: `"7"`},
+		{name: "valid", raw: `7`, id: 7, ok: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{}
+			if tc.raw != "" {
+				p["id"] = json.RawMessage(tc.raw)
+			}
+			if id, ok := p.ID(); id != tc.id || ok != tc.ok {
+				t.Fatalf("expected %d, %v, got %d, %v", tc.id, tc.ok, id, ok)
+			}
+		})
+	}
+}
+
+func TestPanelTitleType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		raw   string
+		value string
+		ok    bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "wrong type", raw: `42`},
+		{name: "empty", raw: `""`, ok: true},
+		{name: "valid", raw: `"graph"`, value: "graph", ok: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{}
+			if tc.raw != "" {
+				p["title"] = json.RawMessage(tc.raw)
+				p["type"] = json.RawMessage(tc.raw)
+			}
+			if title, ok := p.Title(); title != tc.value || ok != tc.ok {
+				t.Errorf("Title: expected %q, %v, got %q, %v", tc.value, tc.ok, title, ok)
+			}
+			if typ, ok := p.Type(); typ != tc.value || ok != tc.ok {
+				t.Errorf("Type: expected %q, %v, got %q, %v", tc.value, tc.ok, typ, ok)
+			}
+		})
+	}
+}
+
+func TestPanelsE(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		d      Dashboard
+		wanted int
+		err    bool
+	}{
+		{name: "no panels", d: Dashboard{}},
+		{name: "empty", d: Dashboard{"panels": json.RawMessage(`[]`)}},
+		{name: "panels", d: Dashboard{"panels": json.RawMessage(`[{"type":"graph"},{"type":"row"}]`)}, wanted: 2},
+		{name: "not a panel", d: Dashboard{"panels": json.RawMessage(`[1]`)}, err: true},
+		{name: "malformed", d: Dashboard{"panels": json.RawMessage(`[{"type":}]`)}, err: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ps, err := tc.d.PanelsE()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				defer func() {
+					if recover() == nil {
+						t.Fatal("expected Panels to panic")
+					}
+				}()
+				tc.d.Panels()
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ps) != tc.wanted {
+				t.Fatalf("expected %d panels, got %d", tc.wanted, len(ps))
+			}
+		})
+	}
+}
+
+func TestGridPosE(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		p      Panel
+		wanted GridPos
+		err    bool
+	}{
+		{name: "absent", p: Panel{}},
+		{name: "valid", p: Panel{"gridPos": json.RawMessage(`{"h":2,"w":6,"x":3,"y":4}`)}, wanted: GridPos{H: 2, W: 6, X: 3, Y: 4}},
+		{name: "partial", p: Panel{"gridPos": json.RawMessage(`{"w":12}`)}, wanted: GridPos{W: 12}},
+		{name: "string", p: Panel{"gridPos": json.RawMessage(`"oops"`)}, err: true},
+		{name: "wrong field type", p: Panel{"gridPos": json.RawMessage(`{"h":"tall"}`)}, err: true},
+		{name: "malformed", p: Panel{"gridPos": json.RawMessage(`{"h":`)}, err: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			gp, err := tc.p.GridPosE()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				defer func() {
+					if recover() == nil {
+						t.Fatal("expected GridPos to panic")
+					}
+				}()
+				tc.p.GridPos()
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wanted, gp); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPanelSetters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		p    Panel
+	}{
+		{name: "empty", p: Panel{}},
+		{
+			name: "existing",
+			p: Panel{
+				"title":   json.RawMessage(`"Old"`),
+				"id":      json.RawMessage(`1`),
+				"gridPos": json.RawMessage(`{"h":1,"w":1,"x":0,"y":0}`),
+			},
+		},
+		{
+			name: "malformed",
+			p: Panel{
+				"title":   json.RawMessage(`42`),
+				"id":      json.RawMessage(`"one"`),
+				"gridPos": json.RawMessage(`"oops"`),
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := tc.p.Clone()
+			gp := GridPos{H: 4, W: 12, X: 6, Y: 8}
+			if err := p.SetGridPos(gp); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.SetID(7); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.SetTitle(`CPU "total"`); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := p.GridPosE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(gp, got); diff != "" {
+				t.Fatalf("unexpected gridPos (-want +got):\n%s", diff)
+			}
+			if id, ok := p.ID(); !ok || id != 7 {
+				t.Fatalf("expected id 7, got %d, %v", id, ok)
+			}
+			if title, ok := p.Title(); !ok || title != `CPU "total"` {
+				t.Fatalf("unexpected title %q, %v", title, ok)
+			}
+		})
+	}
+}
+
+func TestPanelCollapsed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		raw       string
+		collapsed bool
+		ok        bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "not a bool", raw: `"true"`},
+		{name: "false", raw: `false`, ok: true},
+		{name: "true", raw: `true`, collapsed: true, ok: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{"type": json.RawMessage(`"row"`)}
+			if tc.raw != "" {
+				p["collapsed"] = json.RawMessage(tc.raw)
+			}
+			if collapsed, ok := p.Collapsed(); collapsed != tc.collapsed || ok != tc.ok {
+				t.Fatalf("expected %v, %v, got %v, %v", tc.collapsed, tc.ok, collapsed, ok)
+			}
+
+			if err := p.SetCollapsed(!tc.collapsed); err != nil {
+				t.Fatal(err)
+			}
+			if collapsed, ok := p.Collapsed(); collapsed == tc.collapsed || !ok {
+				t.Fatalf("expected %v, true, got %v, %v", !tc.collapsed, collapsed, ok)
+			}
+		})
+	}
+}
+
+func TestPanelTargets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		raw     string
+		targets []json.RawMessage
+		ok      bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "not an array", raw: `{"expr":"up"}`},
+		{name: "empty", raw: `[]`, targets: []json.RawMessage{}, ok: true},
+		{
+			name:    "populated",
+			raw:     `[{"expr":"up"}, {"expr":"down","refId":"B"}]`,
+			targets: []json.RawMessage{json.RawMessage(`{"expr":"up"}`), json.RawMessage(`{"expr":"down","refId":"B"}`)},
+			ok:      true,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{}
+			if tc.raw != "" {
+				p["targets"] = json.RawMessage(tc.raw)
+			}
+			targets, ok := p.Targets()
+			if ok != tc.ok {
+				t.Fatalf("expected %v, got %v", tc.ok, ok)
+			}
+			if diff := cmp.Diff(tc.targets, targets); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPanelDescription(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		raw         string
+		description string
+		ok          bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "not a string", raw: `["notes"]`},
+		{name: "empty", raw: `""`, ok: true},
+		{name: "valid", raw: `"Owned by \"team-a\""`, description: `Owned by "team-a"`, ok: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{}
+			if tc.raw != "" {
+				p["description"] = json.RawMessage(tc.raw)
+			}
+			if description, ok := p.Description(); description != tc.description || ok != tc.ok {
+				t.Fatalf("expected %q, %v, got %q, %v", tc.description, tc.ok, description, ok)
+			}
+
+			if err := p.SetDescription("<b>new</b> notes"); err != nil {
+				t.Fatal(err)
+			}
+			if description, ok := p.Description(); description != "<b>new</b> notes" || !ok {
+				t.Fatalf("unexpected description after set %q, %v", description, ok)
+			}
+		})
+	}
+}
+
+func TestPanelRepeat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		raw    string
+		repeat string
+		ok     bool
+	}{
+		{name: "absent"},
+		{name: "null", raw: `null`},
+		{name: "not a string", raw: `true`},
+		{name: "empty", raw: `""`},
+		{name: "repeated", raw: `"host"`, repeat: "host", ok: true},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{}
+			if tc.raw != "" {
+				p["repeat"] = json.RawMessage(tc.raw)
+			}
+			if repeat, ok := p.Repeat(); repeat != tc.repeat || ok != tc.ok {
+				t.Fatalf("expected %q, %v, got %q, %v", tc.repeat, tc.ok, repeat, ok)
+			}
+		})
+	}
+}
+
+func TestMergePanelsMatchByID(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Old title"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":6,"y":0}`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"New title"`), "type": json.RawMessage(`"stat"`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"C"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`9`)},
+	}
+
+	res := MergePanelsWithResult(base, extra, WithMatchByID())
+
+	type result struct {
+		Title string
+		ID    int
+		X, Y  int
+	}
+	var got []result
+	for _, p := range res.Panels {
+		title, _ := p.Title()
+		id, _ := p.ID()
+		gp := p.GridPos()
+		got = append(got, result{title, id, gp.X, gp.Y})
+	}
+	// the panels without an id do not match, even with the same title and type
+	want := []result{
+		{"New title", 1, 0, 0},
+		{"B", 0, 6, 0},
+		{"B", 2, 0, 3},
+		{"C", 3, 0, 6},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{0}, res.Updated); diff != "" {
+		t.Fatalf("unexpected updated panels (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsAssignIDs(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`3`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`5`)},
+	}
+	extra := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`9`)},
+		{"title": json.RawMessage(`"X"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`3`)},
+		{"title": json.RawMessage(`"Y"`), "type": json.RawMessage(`"graph"`)},
+		{"title": json.RawMessage(`"Z"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`5`)},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		wanted []int
+	}{
+		{
+			name:   "unique ids",
+			wanted: []int{3, 5, 6, 7, 8},
+		},
+		{
+			name:   "preserve ids",
+			opts:   []Option{WithPreserveIDs(true)},
+			wanted: []int{3, 5, 3, 0, 5},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got []int
+			for _, p := range MergePanels(base, extra, tc.opts...) {
+				id, _ := p.ID()
+				got = append(got, id)
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergePanelsDefaultGridPos(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{"title": json.RawMessage(`"Base"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		gridPos json.RawMessage
+		wanted  GridPos
+	}{
+		{
+			name:   "no gridPos",
+			wanted: GridPos{H: 2, W: 6, X: 0, Y: 3},
+		},
+		{
+			name:   "no gridPos with default",
+			opts:   []Option{WithDefaultGridPos(GridPos{H: 8, W: 12, X: 6})},
+			wanted: GridPos{H: 8, W: 12, X: 6, Y: 3},
+		},
+		{
+			name:    "sized",
+			opts:    []Option{WithDefaultGridPos(GridPos{H: 8, W: 12, X: 6})},
+			gridPos: json.RawMessage(`{"h":4,"w":24,"x":3,"y":10}`),
+			wanted:  GridPos{H: 4, W: 24, X: 6, Y: 3},
+		},
+		{
+			name:    "width only",
+			opts:    []Option{WithDefaultGridPos(GridPos{H: 8, W: 12})},
+			gridPos: json.RawMessage(`{"w":18}`),
+			wanted:  GridPos{H: 8, W: 18, X: 0, Y: 3},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := Panel{"title": json.RawMessage(`"New"`), "type": json.RawMessage(`"graph"`)}
+			if tc.gridPos != nil {
+				p["gridPos"] = tc.gridPos
+			}
+			merged := MergePanels(base, []Panel{p}, tc.opts...)
+			if diff := cmp.Diff(tc.wanted, merged[1].GridPos()); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+// ReassignSequentialIDs returns a copy of the panels with ids rewritten to 1..N in document order,
+// including the panels nested in rows, which are numbered right after their row.
+// The input panels are not modified.
+func ReassignSequentialIDs(ps []Panel) []Panel {
+	next := 1
+	return reassignIDs(ps, &next)
+}
+
+func reassignIDs(ps []Panel, next *int) []Panel {
+	res := make([]Panel, 0, len(ps))
+	for _, p := range ps {
+		p = p.Clone()
+		if err := p.SetID(*next); err != nil {
+			panic(err)
+		}
+		*next++
+
+		if p.PanelsRaw() != nil {
+			nested := reassignIDs(retrieveEmbeddedPanels(p), next)
+			if err := p.setField("panels", nested); err != nil {
+				panic(err)
+			}
+		}
+		res = append(res, p)
+	}
+	return res
+}
@@ -0,0 +1,29 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReassignSequentialIDs(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"type": json.RawMessage(`"graph"`), "id": json.RawMessage(`40`)},
+		{"type": json.RawMessage(`"row"`), "id": json.RawMessage(`7`), "panels": json.RawMessage(`[{"id":40,"type":"graph"},{"type":"graph"}]`)},
+		{"type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1000`)},
+	}
+
+	wanted := []Panel{
+		{"type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`)},
+		{"type": json.RawMessage(`"row"`), "id": json.RawMessage(`2`), "panels": json.RawMessage(`[{"id":3,"type":"graph"},{"id":4,"type":"graph"}]`)},
+		{"type": json.RawMessage(`"graph"`), "id": json.RawMessage(`5`)},
+	}
+	if diff := cmp.Diff(wanted, ReassignSequentialIDs(ps)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"cmp"
+	"slices"
+)
+
+// defaultGridWidth is the number of columns of the Grafana grid.
+const defaultGridWidth = 24
+
+// OverlappingPanels is like OverlappingPanelsE but panics on error.
+func OverlappingPanels(ps []Panel, opts ...Option) [][2]int {
+	res, err := OverlappingPanelsE(ps, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// OverlappingPanelsE returns the pairs of indices of the panels whose grid positions overlap.
+// Rows are considered to span the whole width of the grid, see WithGridWidth.
+// It returns a *MergeError if the gridPos of a panel cannot be unmarshalled.
+func OverlappingPanelsE(ps []Panel, opts ...Option) ([][2]int, error) {
+	rects, err := layoutRects(ps, newOptions(opts).gridWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	var res [][2]int
+	for i := range rects {
+		for j := i + 1; j < len(rects); j++ {
+			if rects[i].overlaps(rects[j]) {
+				res = append(res, [2]int{i, j})
+			}
+		}
+	}
+	return res, nil
+}
+
+// CompactLayout is like CompactLayoutE but panics on error.
+func CompactLayout(ps []Panel, opts ...Option) []Panel {
+	res, err := CompactLayoutE(ps, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// CompactLayoutE moves every panel up until it touches a panel or row above it in the same columns,
+// removing vertical gaps in the same way as Grafana does.
+// The X position and size of the panels are preserved.
+// The panels are returned in their original order, the input panels are not modified.
+// Rows are considered to span the whole width of the grid, see WithGridWidth.
+// It returns a *MergeError if the gridPos of a panel cannot be unmarshalled.
+func CompactLayoutE(ps []Panel, opts ...Option) ([]Panel, error) {
+	rects, err := layoutRects(ps, newOptions(opts).gridWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Panel, len(ps))
+	order := make([]int, len(ps))
+	for i := range ps {
+		res[i] = ps[i].Clone()
+		order[i] = i
+	}
+
+	// place the panels top to bottom, left to right
+	slices.SortStableFunc(order, func(a, b int) int {
+		if c := cmp.Compare(rects[a].Y, rects[b].Y); c != 0 {
+			return c
+		}
+		return cmp.Compare(rects[a].X, rects[b].X)
+	})
+
+	placed := make([]GridPos, 0, len(ps))
+	for _, i := range order {
+		r := rects[i]
+
+		// the panel floats up until it hits a panel above it in the same columns,
+		// it never jumps over a panel or a row
+		r.Y = 0
+		for _, o := range placed {
+			if r.X < o.X+o.W && o.X < r.X+r.W {
+				r.Y = max(r.Y, o.Y+o.H)
+			}
+		}
+		placed = append(placed, r)
+
+		gp, err := res[i].GridPosE()
+		if err != nil {
+			return nil, err
+		}
+		gp.Y = r.Y
+		if err := res[i].SetGridPos(gp); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// LayoutGaps is like LayoutGapsE but panics on error.
+func LayoutGaps(ps []Panel, opts ...Option) []GridPos {
+	res, err := LayoutGapsE(ps, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// LayoutGapsE returns the empty areas of the grid above the bottom of the lowest panel,
+// sorted top to bottom and left to right. Rows are considered to span the whole width of the grid,
+// see WithGridWidth.
+//
+// Each gap is a rectangle as wide as possible, consecutive grid lines with an empty area
+// of the same columns are part of the same gap.
+// It returns a *MergeError if the gridPos of a panel cannot be unmarshalled.
+func LayoutGapsE(ps []Panel, opts ...Option) ([]GridPos, error) {
+	width := newOptions(opts).gridWidth
+	rects, err := layoutRects(ps, width)
+	if err != nil {
+		return nil, err
+	}
+	maxY := 0
+	for _, r := range rects {
+		maxY = max(maxY, r.Y+r.H)
+	}
+
+	type span struct{ x, w int }
+	var res []GridPos
+	open := make(map[span]GridPos)
+	for y := 0; y < maxY; y++ {
+		covered := make([]bool, width)
+		for _, r := range rects {
+			if y < r.Y || y >= r.Y+r.H {
+				continue
+			}
+			for x := max(0, r.X); x < min(width, r.X+r.W); x++ {
+				covered[x] = true
+			}
+		}
+
+		next := make(map[span]GridPos)
+		for x := 0; x < width; {
+			if covered[x] {
+				x++
+				continue
+			}
+			s := span{x: x}
+			for x < width && !covered[x] {
+				x++
+			}
+			s.w = x - s.x
+
+			g, ok := open[s]
+			if ok {
+				g.H++
+			} else {
+				g = GridPos{X: s.x, Y: y, W: s.w, H: 1}
+			}
+			next[s] = g
+		}
+
+		for s, g := range open {
+			if _, ok := next[s]; !ok {
+				res = append(res, g)
+			}
+		}
+		open = next
+	}
+	for _, g := range open {
+		res = append(res, g)
+	}
+
+	slices.SortFunc(res, func(a, b GridPos) int {
+		if c := cmp.Compare(a.Y, b.Y); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.X, b.X)
+	})
+	return res, nil
+}
+
+func overlapsAny(r GridPos, rects []GridPos) bool {
+	for _, o := range rects {
+		if r.overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutPanel is a panel along with the fields used to lay it out, parsed once
+// so that checking and laying out the panels does not unmarshal them on every access.
+type layoutPanel struct {
+	p         Panel
+	pos       GridPos
+	hasPos    bool
+	row       bool
+	collapsed bool
+}
+
+// parseLayout parses the layout fields of the panels.
+func parseLayout(ps []Panel) ([]layoutPanel, error) {
+	res := make([]layoutPanel, len(ps))
+	for i, p := range ps {
+		pos, err := p.GridPosE()
+		if err != nil {
+			return nil, err
+		}
+		res[i] = layoutPanel{
+			p:         p,
+			pos:       pos,
+			hasPos:    p.GridPosRaw() != nil,
+			row:       p.isRow(),
+			collapsed: p.collapsed(),
+		}
+	}
+	return res, nil
+}
+
+// layOut makes the grid positions of the panels consistent, in place, according to the options,
+// see WithBinPack and WithPreserveColumns.
+func layOut(ps []Panel, o options) error {
+	lps, err := parseLayout(ps)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case o.binPack:
+		packSections(lps, o.gridWidth, firstFit)
+	case o.preserveColumns:
+		packSections(lps, o.gridWidth, columnFit)
+	case o.sortAppended || !layoutConsistent(lps, o.gridWidth):
+		// keep the layout if it is still valid, so that merging is idempotent,
+		// sorted groups are always laid out again to follow the new order
+		relayout(lps, o.gridWidth)
+	default:
+		return nil
+	}
+
+	for _, lp := range lps {
+		if err := lp.p.SetGridPos(lp.pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relayout flows the panels left to right, top to bottom, in a grid of the given width.
+func relayout(ps []layoutPanel, width int) {
+	currentY := 0
+	currentRowWidth := 0
+	currentRowMaxBottom := 0 // Track tallest panel in row for next Y
+
+	for i := range ps {
+		pos := &ps[i].pos
+		// Oversized panels are shrunk to the grid width and get a row of their own
+		if pos.W > width {
+			pos.W = width
+		}
+		if currentRowWidth+pos.W > width {
+			// New row
+			currentY += currentRowMaxBottom
+			currentRowWidth = 0
+			currentRowMaxBottom = 0
+		}
+		// Place at next X in row
+		pos.X = currentRowWidth
+		pos.Y = currentY
+		// Update row tracking
+		currentRowWidth += pos.W
+		if pos.H > currentRowMaxBottom {
+			currentRowMaxBottom = pos.H
+		}
+	}
+}
+
+// layoutConsistent reports whether the grid positions of the panels already form a valid layout
+// in a grid of the given width: every row is below all the panels before it, every other panel
+// is below its row, fits in the grid and does not overlap the other panels.
+// The panels following a collapsed row are embedded in it, so their position is not checked.
+func layoutConsistent(ps []layoutPanel, width int) bool {
+	var placed []GridPos
+	top, bottom := 0, 0
+	collapsed := false
+
+	for _, p := range ps {
+		gp := p.pos
+		if !p.hasPos {
+			return false
+		}
+
+		if p.row {
+			if gp.Y < bottom {
+				return false
+			}
+			collapsed = p.collapsed
+			placed = nil
+			bottom = gp.Y + gp.H
+			top = bottom
+			continue
+		}
+		if collapsed {
+			continue
+		}
+
+		if gp.X < 0 || gp.W <= 0 || gp.X+gp.W > width || gp.Y < top || overlapsAny(gp, placed) {
+			return false
+		}
+		placed = append(placed, gp)
+		bottom = max(bottom, gp.Y+gp.H)
+	}
+	return true
+}
+
+// packSections places the panels one at a time in a grid of the given width,
+// at the position returned by fit.
+// Rows span the whole width and start a new section below all the previous panels,
+// so panels never move across rows.
+func packSections(ps []layoutPanel, width int, fit func(r GridPos, placed []GridPos, top, width int) (x, y int)) {
+	var placed []GridPos
+	top, bottom := 0, 0
+
+	for i := range ps {
+		pos := &ps[i].pos
+		pos.W = min(pos.W, width)
+
+		if ps[i].row {
+			pos.X, pos.Y = 0, bottom
+			placed = nil
+			bottom = pos.Y + pos.H
+			top = bottom
+		} else {
+			pos.X, pos.Y = fit(*pos, placed, top, width)
+			placed = append(placed, *pos)
+			bottom = max(bottom, pos.Y+pos.H)
+		}
+	}
+}
+
+// firstFit returns the top-most, then left-most, position at or below top where r
+// fits in a grid of the given width without overlapping any of the placed rects.
+func firstFit(r GridPos, placed []GridPos, top, width int) (x, y int) {
+	// the panel can only land at the top or left edge or right below or next to another panel
+	ys := []int{top}
+	xs := []int{0}
+	for _, o := range placed {
+		ys = append(ys, o.Y+o.H)
+		xs = append(xs, o.X+o.W)
+	}
+	slices.Sort(ys)
+	slices.Sort(xs)
+
+	for _, y := range ys {
+		for _, x := range xs {
+			if x+r.W > width {
+				break
+			}
+			r.X, r.Y = x, y
+			if !overlapsAny(r, placed) {
+				return x, y
+			}
+		}
+	}
+	// unreachable, the panel always fits below all the placed panels
+	return 0, ys[len(ys)-1]
+}
+
+// columnFit returns the top-most position at or below top where r fits in its own
+// columns without overlapping any of the placed rects.
+// Panels that do not fit in a grid of the given width are moved left.
+func columnFit(r GridPos, placed []GridPos, top, width int) (x, y int) {
+	r.X = max(0, min(r.X, width-r.W))
+
+	ys := []int{top}
+	for _, o := range placed {
+		ys = append(ys, o.Y+o.H)
+	}
+	slices.Sort(ys)
+
+	for _, y := range ys {
+		r.Y = y
+		if !overlapsAny(r, placed) {
+			return r.X, y
+		}
+	}
+	return r.X, ys[len(ys)-1]
+}
+
+// layoutRects returns the areas of a grid of the given width occupied by the panels.
+func layoutRects(ps []Panel, width int) ([]GridPos, error) {
+	rects := make([]GridPos, len(ps))
+	for i, p := range ps {
+		gp, err := p.GridPosE()
+		if err != nil {
+			return nil, err
+		}
+		if p.isRow() {
+			gp.X, gp.W = 0, width
+		}
+		rects[i] = gp
+	}
+	return rects, nil
+}
+
+func (gp GridPos) overlaps(o GridPos) bool {
+	return gp.X < o.X+o.W && o.X < gp.X+gp.W &&
+		gp.Y < o.Y+o.H && o.Y < gp.Y+gp.H
+}
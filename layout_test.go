@@ -0,0 +1,383 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOverlappingPanels(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":12,"y":0}`)},
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":6,"x":10,"y":2}`)},
+		{"type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":0,"x":0,"y":6}`)},
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":18,"y":6}`)},
+	}
+
+	want := [][2]int{{0, 2}, {1, 2}, {3, 4}}
+	if diff := cmp.Diff(want, OverlappingPanels(ps)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	var me *MergeError
+	if _, err := OverlappingPanelsE([]Panel{{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`"oops"`)}}); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
+
+func TestCompactLayout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		ps     []Panel
+		wanted []GridPos
+	}{
+		{
+			name: "gaps",
+			ps: []Panel{
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":12,"y":0}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":12,"y":6}`)},
+				{"type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":10}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":15}`)},
+			},
+			wanted: []GridPos{
+				{H: 4, W: 12, X: 0, Y: 0},
+				{H: 2, W: 12, X: 12, Y: 0},
+				{H: 2, W: 12, X: 12, Y: 2},
+				{H: 1, W: 24, X: 0, Y: 4},
+				{H: 2, W: 6, X: 0, Y: 5},
+			},
+		},
+		{
+			name: "no jump over row",
+			ps: []Panel{
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":12,"y":0}`)},
+				{"type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":4}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":12,"y":5}`)},
+			},
+			wanted: []GridPos{
+				{H: 4, W: 12, X: 0, Y: 0},
+				{H: 2, W: 12, X: 12, Y: 0},
+				{H: 1, W: 24, X: 0, Y: 4},
+				{H: 2, W: 12, X: 12, Y: 5},
+			},
+		},
+		{
+			name: "no jump over panel",
+			ps: []Panel{
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":0,"y":3}`)},
+				{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":1,"w":6,"x":6,"y":8}`)},
+			},
+			wanted: []GridPos{
+				{H: 2, W: 12, X: 0, Y: 0},
+				{H: 1, W: 6, X: 6, Y: 2},
+			},
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got []GridPos
+			for _, p := range CompactLayout(tc.ps) {
+				got = append(got, p.GridPos())
+			}
+			if diff := cmp.Diff(tc.wanted, got); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	var me *MergeError
+	if _, err := CompactLayoutE([]Panel{{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`"oops"`)}}); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
+
+func TestGridWidth(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":6,"y":0}`)},
+		{"title": json.RawMessage(`"C"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":12,"y":0}`)},
+		{"title": json.RawMessage(`"Row"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":2}`)},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		layout []GridPos
+		gaps   []GridPos
+		errs   int
+	}{
+		{
+			name: "default",
+			layout: []GridPos{
+				{H: 2, W: 6, X: 0, Y: 0},
+				{H: 2, W: 6, X: 6, Y: 0},
+				{H: 2, W: 6, X: 12, Y: 0},
+				{H: 1, W: 24, X: 0, Y: 2},
+			},
+			gaps: []GridPos{{H: 2, W: 6, X: 18, Y: 0}},
+		},
+		{
+			name: "ignored",
+			opts: []Option{WithGridWidth(0)},
+			layout: []GridPos{
+				{H: 2, W: 6, X: 0, Y: 0},
+				{H: 2, W: 6, X: 6, Y: 0},
+				{H: 2, W: 6, X: 12, Y: 0},
+				{H: 1, W: 24, X: 0, Y: 2},
+			},
+			gaps: []GridPos{{H: 2, W: 6, X: 18, Y: 0}},
+		},
+		{
+			name: "narrow",
+			opts: []Option{WithGridWidth(12)},
+			layout: []GridPos{
+				{H: 2, W: 6, X: 0, Y: 0},
+				{H: 2, W: 6, X: 6, Y: 0},
+				{H: 2, W: 6, X: 0, Y: 2},
+				{H: 1, W: 12, X: 0, Y: 4},
+			},
+			// the row is wider than the grid
+			errs: 1,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []GridPos
+			for _, p := range MergePanelsByGroup(ps, nil, false, tc.opts...) {
+				got = append(got, p.GridPos())
+			}
+			if diff := cmp.Diff(tc.layout, got); diff != "" {
+				t.Fatalf("unexpected layout (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.gaps, LayoutGaps(ps, tc.opts...)); diff != "" {
+				t.Fatalf("unexpected gaps (-want +got):\n%s", diff)
+			}
+
+			raw, err := json.Marshal(ps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errs := (Dashboard{"panels": raw}).Validate(tc.opts...); len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+		})
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"type": json.RawMessage(`"row"`), "collapsed": json.RawMessage(`true`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":0}`)},
+		{"type": json.RawMessage(`"graph"`)},
+	}
+	lps, err := parseLayout(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []layoutPanel{
+		{p: ps[0], pos: GridPos{H: 1, W: 24}, hasPos: true, row: true, collapsed: true},
+		{p: ps[1]},
+	}
+	if diff := cmp.Diff(want, lps, cmp.AllowUnexported(layoutPanel{})); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	var me *MergeError
+	if _, err := parseLayout([]Panel{{"gridPos": json.RawMessage(`"oops"`)}}); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
+
+func TestLayOut(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		gp     string
+		wanted string
+	}{
+		{
+			name:   "overflowing",
+			gp:     `{"h":2,"w":6,"x":20,"y":0}`,
+			wanted: `{"h":2,"w":6,"x":0,"y":0}`,
+		},
+		{
+			name:   "consistent",
+			gp:     `{ "h": 2, "w": 6, "x": 0, "y": 0 }`,
+			wanted: `{ "h": 2, "w": 6, "x": 0, "y": 0 }`,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ps := []Panel{{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(tc.gp)}}
+			if err := layOut(ps, newOptions(nil)); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wanted, string(ps[0].GridPosRaw())); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLayoutGaps(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":12,"y":0}`)},
+		{"type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":0,"x":0,"y":5}`)},
+		{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":24,"x":0,"y":6}`)},
+	}
+
+	want := []GridPos{
+		{H: 2, W: 6, X: 18, Y: 0},
+		{H: 2, W: 12, X: 12, Y: 2},
+		{H: 1, W: 24, X: 0, Y: 4},
+	}
+	if diff := cmp.Diff(want, LayoutGaps(ps)); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if gaps := LayoutGaps(nil); len(gaps) != 0 {
+		t.Fatalf("expected no gaps, got %v", gaps)
+	}
+
+	var me *MergeError
+	if _, err := LayoutGapsE([]Panel{{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`"oops"`)}}); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
+
+func TestMergePanelsByGroupClampsWidth(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"title": json.RawMessage(`"Small"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"Wide"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":3,"w":30,"x":0,"y":2}`)},
+		{"title": json.RawMessage(`"After"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":5}`)},
+	}
+
+	var got []GridPos
+	for _, p := range MergePanelsByGroup(ps, nil, false) {
+		got = append(got, p.GridPos())
+	}
+	want := []GridPos{
+		{H: 2, W: 6, X: 0, Y: 0},
+		{H: 3, W: 24, X: 0, Y: 2},
+		{H: 2, W: 6, X: 0, Y: 5},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsByGroupBinPack(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"B"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":12,"y":0}`)},
+		{"title": json.RawMessage(`"C"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":2,"w":12,"x":0,"y":4}`)},
+		{"title": json.RawMessage(`"D"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":12,"y":4}`)},
+		{"title": json.RawMessage(`"Row"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":6}`)},
+		{"title": json.RawMessage(`"E"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":7}`)},
+	}
+
+	var got []GridPos
+	for _, p := range MergePanelsByGroup(ps, nil, false, WithBinPack()) {
+		got = append(got, p.GridPos())
+	}
+
+	want := []GridPos{
+		{H: 4, W: 12, X: 0, Y: 0},
+		{H: 2, W: 12, X: 12, Y: 0},
+		{H: 2, W: 12, X: 12, Y: 2},
+		{H: 2, W: 6, X: 0, Y: 4},
+		{H: 1, W: 24, X: 0, Y: 6},
+		{H: 2, W: 6, X: 0, Y: 7},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsByGroupPreserveColumns(t *testing.T) {
+	t.Parallel()
+
+	ps1 := []Panel{
+		{"title": json.RawMessage(`"Left"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"Right"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":8,"w":12,"x":12,"y":0}`)},
+		{"title": json.RawMessage(`"Row"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":8}`)},
+		{"title": json.RawMessage(`"R1"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":8,"x":16,"y":9}`)},
+	}
+	ps2 := []Panel{
+		{"title": json.RawMessage(`"Left2"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+	}
+
+	var got []GridPos
+	for _, p := range MergePanelsByGroup(ps1, ps2, false, WithPreserveColumns()) {
+		got = append(got, p.GridPos())
+	}
+
+	want := []GridPos{
+		{H: 4, W: 12, X: 0, Y: 0},
+		{H: 8, W: 12, X: 12, Y: 0},
+		{H: 4, W: 12, X: 0, Y: 4},
+		{H: 1, W: 24, X: 0, Y: 8},
+		{H: 4, W: 8, X: 16, Y: 9},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestMergePanelsByGroupNoRelayout(t *testing.T) {
+	t.Parallel()
+
+	ps1 := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":10,"x":3,"y":2}`)},
+		{"title": json.RawMessage(`"Row"`), "type": json.RawMessage(`"row"`), "gridPos": json.RawMessage(`{"h":1,"w":24,"x":0,"y":20}`)},
+		{"title": json.RawMessage(`"R1"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":8,"x":16,"y":21}`)},
+	}
+	ps2 := []Panel{
+		{"title": json.RawMessage(`"A"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":6,"w":6,"x":0,"y":0}`)},
+	}
+
+	var got []GridPos
+	for _, p := range MergePanelsByGroup(ps1, ps2, false, WithNoRelayout()) {
+		got = append(got, p.GridPos())
+	}
+
+	want := []GridPos{
+		{H: 4, W: 10, X: 3, Y: 2},
+		{H: 1, W: 24, X: 0, Y: 20},
+		{H: 4, W: 8, X: 16, Y: 21},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
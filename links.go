@@ -0,0 +1,69 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Links returns the dashboard links.
+// A missing links field is reported as an empty slice.
+func (d Dashboard) Links() ([]json.RawMessage, error) {
+	raw, ok := d["links"]
+	if !ok {
+		return []json.RawMessage{}, nil
+	}
+	var links []json.RawMessage
+	if err := json.Unmarshal(raw, &links); err != nil {
+		return nil, fmt.Errorf("unmarshal links: %w", err)
+	}
+	if links == nil {
+		links = []json.RawMessage{}
+	}
+	return links, nil
+}
+
+// Links returns the elements of the panel links array and whether it is present.
+func (p Panel) Links() ([]json.RawMessage, bool) {
+	return p.arrayField("links")
+}
+
+// unionLinks returns the links in l1 followed by the links in l2 that are not in l1.
+// Links are identified by their title and url, links with neither, e.g. links to
+// the dashboards with given tags, are identified by their whole content.
+func unionLinks(l1, l2 []json.RawMessage) []json.RawMessage {
+	seen := make(map[string]bool, len(l1)+len(l2))
+	res := make([]json.RawMessage, 0, len(l1)+len(l2))
+	for _, l := range [][]json.RawMessage{l1, l2} {
+		for _, link := range l {
+			if k, ok := linkKey(link); ok {
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+			}
+			res = append(res, link)
+		}
+	}
+	return res
+}
+
+// linkKey returns the key identifying the link in unionLinks and whether the link is valid.
+func linkKey(link json.RawMessage) (string, bool) {
+	var k struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	if err := json.Unmarshal(link, &k); err != nil {
+		return "", false
+	}
+	if k.Title != "" || k.URL != "" {
+		return fmt.Sprintf("%d:%s%s", len(k.Title), k.Title, k.URL), true
+	}
+	c, err := canonicalize(link)
+	if err != nil {
+		return "", false
+	}
+	return "#" + string(c), true
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// normalizeMappings returns a copy of the panel where the value mappings in
+// fieldConfig.defaults.mappings are rewritten in a canonical form, so that mappings
+// written in the legacy form used before Grafana 8, e.g. {"type":1,"value":"1","text":"Up"},
+// compare equal to the same mappings written in the current form,
+// e.g. {"type":"value","options":{"1":{"text":"Up"}}}.
+//
+// In the canonical form every mapping has a single option and results have no index,
+// the options of value mappings are sorted by index.
+// Panels whose mappings cannot be unmarshalled are returned as they are.
+func normalizeMappings(p Panel) Panel {
+	var fieldConfig, defaults map[string]json.RawMessage
+	if err := json.Unmarshal(p["fieldConfig"], &fieldConfig); err != nil {
+		return p
+	}
+	if err := json.Unmarshal(fieldConfig["defaults"], &defaults); err != nil {
+		return p
+	}
+	raw, ok := defaults["mappings"]
+	if !ok {
+		return p
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var mappings []map[string]any
+	if err := dec.Decode(&mappings); err != nil {
+		return p
+	}
+
+	res := make([]any, 0, len(mappings))
+	for _, m := range mappings {
+		if t, ok := m["type"].(string); ok {
+			res = append(res, normalizeMapping(t, m)...)
+		} else {
+			res = append(res, legacyMapping(m))
+		}
+	}
+
+	p = p.Clone()
+	if err := setField(defaults, "mappings", res); err != nil {
+		panic(err)
+	}
+	if err := setField(fieldConfig, "defaults", defaults); err != nil {
+		panic(err)
+	}
+	if err := p.setField("fieldConfig", fieldConfig); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// normalizeMapping returns the canonical form of a mapping of the given type in the current form.
+func normalizeMapping(t string, m map[string]any) []any {
+	opts, ok := m["options"].(map[string]any)
+	if !ok {
+		return []any{m}
+	}
+
+	if t != "value" {
+		o := make(map[string]any, len(opts))
+		for k, v := range opts {
+			o[k] = v
+		}
+		if r, ok := o["result"]; ok {
+			o["result"] = withoutIndex(r)
+		}
+		if t == "range" {
+			o["from"], o["to"] = mappingNumber(o["from"]), mappingNumber(o["to"])
+		}
+		return []any{map[string]any{"type": t, "options": o}}
+	}
+
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := cmp.Compare(mappingIndex(opts[a]), mappingIndex(opts[b])); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	res := make([]any, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, map[string]any{
+			"type":    "value",
+			"options": map[string]any{k: withoutIndex(opts[k])},
+		})
+	}
+	return res
+}
+
+// legacyMapping returns the canonical form of a mapping in the legacy form,
+// where type 1 maps a value and type 2 maps a range.
+func legacyMapping(m map[string]any) any {
+	result := map[string]any{"text": m["text"]}
+
+	if mappingString(m["type"]) == "2" {
+		return map[string]any{
+			"type": "range",
+			"options": map[string]any{
+				"from":   mappingNumber(m["from"]),
+				"to":     mappingNumber(m["to"]),
+				"result": result,
+			},
+		}
+	}
+
+	value := mappingString(m["value"])
+	if value == "null" {
+		return map[string]any{
+			"type":    "special",
+			"options": map[string]any{"match": "null", "result": result},
+		}
+	}
+	return map[string]any{
+		"type":    "value",
+		"options": map[string]any{value: result},
+	}
+}
+
+// withoutIndex returns a copy of the mapping result without its index.
+func withoutIndex(v any) any {
+	r, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	res := make(map[string]any, len(r))
+	for k, v := range r {
+		if k != "index" {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func mappingIndex(v any) float64 {
+	r, _ := v.(map[string]any)
+	n, _ := mappingNumber(r["index"]).(json.Number)
+	f, _ := n.Float64()
+	return f
+}
+
+// mappingNumber returns the number in v, which may also be written as a string
+// in legacy mappings, or nil if v is not a number.
+func mappingNumber(v any) any {
+	f, err := strconv.ParseFloat(mappingString(v), 64)
+	if err != nil {
+		return nil
+	}
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func mappingString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
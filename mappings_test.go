@@ -0,0 +1,54 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNormalizeMappings(t *testing.T) {
+	t.Parallel()
+
+	panel := func(mappings string) Panel {
+		return Panel{
+			"title":       json.RawMessage(`"Status"`),
+			"fieldConfig": json.RawMessage(`{"defaults":{"unit":"short","mappings":` + mappings + `}}`),
+		}
+	}
+
+	legacy := panel(`[
+		{"id":0,"type":1,"value":"1","text":"Up","op":"="},
+		{"id":1,"type":1,"value":"0","text":"Down"},
+		{"id":2,"type":1,"value":"null","text":"N/A"},
+		{"id":3,"type":2,"from":"10","to":"20.0","text":"Busy"}
+	]`)
+	current := panel(`[
+		{"type":"value","options":{"0":{"text":"Down","index":1},"1":{"text":"Up","index":0}}},
+		{"type":"special","options":{"match":"null","result":{"text":"N/A","index":2}}},
+		{"type":"range","options":{"from":10,"to":20,"result":{"text":"Busy","index":3}}}
+	]`)
+	different := panel(`[
+		{"type":"value","options":{"0":{"text":"Down","index":0},"1":{"text":"Up","index":1}}},
+		{"type":"special","options":{"match":"null","result":{"text":"N/A","index":2}}},
+		{"type":"range","options":{"from":10,"to":20,"result":{"text":"Busy","index":3}}}
+	]`)
+
+	if legacy.DeepEquals(current) {
+		t.Fatal("expected mappings in different forms to differ by default")
+	}
+	if !legacy.DeepEquals(current, WithNormalizeMappings()) {
+		t.Error("expected the same mappings in different forms to be equal")
+	}
+	if legacy.ContentHash(WithNormalizeMappings()) != current.ContentHash(WithNormalizeMappings()) {
+		t.Error("expected the same mappings in different forms to have the same hash")
+	}
+	if legacy.DeepEquals(different, WithNormalizeMappings()) {
+		t.Error("expected mappings in a different order to differ")
+	}
+
+	noMappings := Panel{"title": json.RawMessage(`"Status"`), "fieldConfig": json.RawMessage(`{"defaults":{}}`)}
+	if !noMappings.DeepEquals(noMappings.Clone(), WithNormalizeMappings()) {
+		t.Error("expected panels without mappings to be unchanged")
+	}
+}
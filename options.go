@@ -0,0 +1,358 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import "strconv"
+
+// Option configures the behavior of the merge functions.
+type Option func(*options)
+
+type options struct {
+	placement *Placement
+	match     func(a, b Panel) bool
+	matchKey  func(Panel) (string, bool)
+	matchName func(Panel) string
+
+	preserveIDs     bool
+	maxID           *int
+	onMatch         func(old, new Panel)
+	defaultGridPos  GridPos
+	keepTargets     bool
+	preserveFields  []string
+	mergeLinks      bool
+	mergeOverrides  bool
+	preferNewLayout bool
+	titlePrefix     string
+	matchWithinRow  bool
+	sortAppended    bool
+	appendGap       int
+
+	ignoreDatasourceFormat bool
+	normalizeMappings      bool
+
+	expandRows            bool
+	gridWidth             int
+	keepUngroupedPosition bool
+	binPack               bool
+	preserveColumns       bool
+	noRelayout            bool
+
+	migrate      func(Dashboard) (Dashboard, error)
+	timeSettings TimeSettings
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		match:     Panel.Equals,
+		matchKey:  equalsKey,
+		matchName: panelKey,
+		gridWidth: defaultGridWidth,
+		appendGap: 1,
+		defaultGridPos: GridPos{
+			H: 2,
+			W: 6,
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithTop appends new groups and panels to the top of the dashboard
+// instead of the bottom.
+func WithTop(top bool) Option {
+	if top {
+		return WithPlacement(AppendTop)
+	}
+	return WithPlacement(AppendBottom)
+}
+
+// Placement controls where MergePanelsByGroup places the groups that are only in ps2.
+type Placement int
+
+const (
+	// AppendBottom places the new groups at the bottom of the dashboard.
+	AppendBottom Placement = iota
+	// AppendTop places the new groups at the top of the dashboard.
+	AppendTop
+	// AppendAfterMatching places each new group right after the group that
+	// precedes it in ps2 and is also in ps1, existing groups stay in place.
+	AppendAfterMatching
+)
+
+// WithPlacement sets where MergePanelsByGroup places the groups that are only in ps2,
+// it takes precedence over the top argument.
+func WithPlacement(p Placement) Option {
+	return func(o *options) {
+		o.placement = &p
+	}
+}
+
+// WithMatcher sets the function used to decide whether two panels match.
+// The default is Panel.Equals, which compares title and type.
+func WithMatcher(match func(a, b Panel) bool) Option {
+	return func(o *options) {
+		o.match = match
+		o.matchKey = nil
+		o.matchName = panelKey
+	}
+}
+
+// WithMatchByID matches panels by their id instead of title and type.
+// Panels without an id never match.
+func WithMatchByID() Option {
+	return func(o *options) {
+		o.match = func(a, b Panel) bool {
+			id1, ok1 := a.ID()
+			id2, ok2 := b.ID()
+			return ok1 && ok2 && id1 == id2
+		}
+		o.matchKey = func(p Panel) (string, bool) {
+			id, ok := p.ID()
+			return strconv.Itoa(id), ok
+		}
+		o.matchName = func(p Panel) string {
+			id, _ := p.ID()
+			return "id " + strconv.Itoa(id)
+		}
+	}
+}
+
+// WithPreserveIDs keeps the original ids of panels appended by MergePanels.
+// By default appended panels are given a new unique id.
+func WithPreserveIDs(preserve bool) Option {
+	return func(o *options) {
+		o.preserveIDs = preserve
+	}
+}
+
+// withMaxID shares the maximum panel id between multiple MergePanels calls.
+func withMaxID(maxID *int) Option {
+	return func(o *options) {
+		o.maxID = maxID
+	}
+}
+
+// WithExpandRows makes MergePanelsByGroup expand collapsed rows,
+// moving their embedded panels to the top level.
+func WithExpandRows(expand bool) Option {
+	return func(o *options) {
+		o.expandRows = expand
+	}
+}
+
+// WithGridWidth sets the number of columns of the grid used to lay out and check the panels,
+// see MergePanelsByGroup, CompactLayout, OverlappingPanels, LayoutGaps and Dashboard.Validate.
+// The default is 24, as in Grafana. Non-positive widths are ignored.
+func WithGridWidth(width int) Option {
+	return func(o *options) {
+		if width > 0 {
+			o.gridWidth = width
+		}
+	}
+}
+
+// WithAppendGap sets the number of grid units left empty above each panel appended by MergePanels.
+// The default is 1, zero stacks the appended panels flush, negative gaps are treated as zero.
+func WithAppendGap(gap int) Option {
+	return func(o *options) {
+		o.appendGap = max(gap, 0)
+	}
+}
+
+// WithDefaultGridPos sets the grid position of panels appended by MergePanels
+// that do not have one. The Y position is always computed.
+// The default is a 6x2 panel at X 0.
+func WithDefaultGridPos(gp GridPos) Option {
+	return func(o *options) {
+		o.defaultGridPos = gp
+	}
+}
+
+// WithMigration sets a function called by MergeDashboards on a copy of both dashboards
+// before merging them, e.g. to upgrade old schema versions or to reject
+// dashboards with incompatible ones, see Dashboard.SchemaVersion.
+func WithMigration(migrate func(Dashboard) (Dashboard, error)) Option {
+	return func(o *options) {
+		o.migrate = migrate
+	}
+}
+
+// WithKeepTargets makes MergePanels keep the targets of the panel in ps1 when
+// a panel matches, while the rest of the content is taken from the panel in ps2.
+// It has no effect if either panel has no targets.
+func WithKeepTargets() Option {
+	return func(o *options) {
+		o.keepTargets = true
+	}
+}
+
+// WithPreserveFields makes MergePanels keep the given top-level fields of the panel
+// in ps1 when a panel matches, in addition to gridPos and id.
+// Fields that are not present in the panel in ps1 are taken from the panel in ps2.
+func WithPreserveFields(keys ...string) Option {
+	return func(o *options) {
+		o.preserveFields = append(o.preserveFields, keys...)
+	}
+}
+
+// WithPreserveDescription makes MergePanels keep the description of the panel in ps1
+// when a panel matches, it is a shorthand for WithPreserveFields("description").
+func WithPreserveDescription() Option {
+	return WithPreserveFields("description")
+}
+
+// WithPreserveLibraryPanels makes MergePanels keep the library panel reference of the panel in ps1
+// when a panel matches, so that the merged panel stays linked to the library panel,
+// see Panel.LibraryPanel. It is a shorthand for WithPreserveFields("libraryPanel").
+func WithPreserveLibraryPanels() Option {
+	return WithPreserveFields("libraryPanel")
+}
+
+// WithPreserveTransformations makes MergePanels keep the transformations of the panel in ps1
+// when a panel matches, see Panel.Transformations.
+// It is a shorthand for WithPreserveFields("transformations").
+func WithPreserveTransformations() Option {
+	return WithPreserveFields("transformations")
+}
+
+// withOnMatch sets a function called by MergePanels for every matched panel before it is overwritten.
+func withOnMatch(fn func(old, new Panel)) Option {
+	return func(o *options) {
+		o.onMatch = fn
+	}
+}
+
+// WithKeepUngroupedPosition makes MergePanelsByGroup keep the panels that do not belong
+// to any row right before the rows of ps1, instead of moving them to the very top
+// of the dashboard when new groups are appended to the top.
+func WithKeepUngroupedPosition() Option {
+	return func(o *options) {
+		o.keepUngroupedPosition = true
+	}
+}
+
+// WithMergeLinks makes MergePanels keep the links of the panel in ps1 when a panel matches,
+// followed by the links of the panel in ps2 with a different title or url.
+func WithMergeLinks() Option {
+	return func(o *options) {
+		o.mergeLinks = true
+	}
+}
+
+// WithPreferNewLayout makes MergePanels take the gridPos of the panel in ps2 when a panel matches,
+// instead of preserving the position of the panel in ps1. The id is still preserved.
+func WithPreferNewLayout() Option {
+	return func(o *options) {
+		o.preferNewLayout = true
+	}
+}
+
+// WithBinPack makes MergePanelsByGroup place every panel in the first gap of its row
+// large enough to hold it, instead of flowing the panels left to right.
+// This produces a denser layout when the panels have different sizes.
+func WithBinPack() Option {
+	return func(o *options) {
+		o.binPack = true
+	}
+}
+
+// WithPreserveColumns makes MergePanelsByGroup keep the X position and width of every panel,
+// only moving the panels up or down to stack the groups without overlaps.
+// WithBinPack takes precedence over it.
+func WithPreserveColumns() Option {
+	return func(o *options) {
+		o.preserveColumns = true
+	}
+}
+
+// WithNoRelayout makes MergePanelsByGroup keep the grid positions of the panels as they are,
+// instead of laying them out again after merging. It takes precedence over the other layout options.
+// Panels appended by MergePanels are still placed below the other panels of their group.
+func WithNoRelayout() Option {
+	return func(o *options) {
+		o.noRelayout = true
+	}
+}
+
+// WithIgnoreDatasourceFormat makes DiffPanels, DedupePanels and Panel.DeepEquals ignore the datasource
+// references that use the legacy string form, e.g. "Prometheus", in one panel and the {"type", "uid"} form
+// in the other, since a name cannot be related to a uid without the datasource list.
+// References in the same form are still compared, so panels querying different uids differ.
+// The references of the panels and of their targets at the same index are compared separately,
+// see Panel.ContentHash for how the option affects hashing.
+func WithIgnoreDatasourceFormat() Option {
+	return func(o *options) {
+		o.ignoreDatasourceFormat = true
+	}
+}
+
+// TimeSettings controls where MergeDashboards takes the time, timezone and refresh fields from.
+type TimeSettings int
+
+const (
+	// TimeSettingsFromBase takes the time settings from d1.
+	TimeSettingsFromBase TimeSettings = iota
+	// TimeSettingsFromMerged takes the time settings from d2 when present.
+	TimeSettingsFromMerged
+	// TimeSettingsFillMissing takes the time settings from d1 and the ones missing in d1 from d2.
+	TimeSettingsFillMissing
+)
+
+// timeSettingsFields are the top-level dashboard fields controlled by WithTimeSettings.
+var timeSettingsFields = []string{"time", "timezone", "refresh"}
+
+// WithTimeSettings sets where MergeDashboards takes the time, timezone and refresh fields from,
+// see Dashboard.Time, Dashboard.Timezone and Dashboard.Refresh.
+// The default is TimeSettingsFromBase.
+func WithTimeSettings(ts TimeSettings) Option {
+	return func(o *options) {
+		o.timeSettings = ts
+	}
+}
+
+// WithTitlePrefix makes MergePanels prepend prefix to the titles of the panels appended from ps2,
+// e.g. "[team-a] ", to tell them apart from the existing panels. Matched panels keep their title.
+// MergePanelsByGroup also prefixes the panels of the groups that are only in ps2, but not their rows.
+func WithTitlePrefix(prefix string) Option {
+	return func(o *options) {
+		o.titlePrefix = prefix
+	}
+}
+
+// WithNormalizeMappings makes DiffPanels, DedupePanels, Panel.DeepEquals and Panel.ContentHash
+// compare the value mappings of the panels in a canonical form, so that mappings written
+// in the legacy form used before Grafana 8 compare equal to the same mappings in the current form.
+func WithNormalizeMappings() Option {
+	return func(o *options) {
+		o.normalizeMappings = true
+	}
+}
+
+// WithMatchWithinRow makes MergePanels match only panels that belong to the same row,
+// rows are told apart by title and position as in GroupByRow.
+// MergePanelsByGroup always matches panels within their row.
+func WithMatchWithinRow() Option {
+	return func(o *options) {
+		o.matchWithinRow = true
+	}
+}
+
+// WithMergeFieldOverrides makes MergePanels keep the field overrides of the panel in ps1 when a panel matches,
+// followed by the overrides of the panel in ps2 with a different matcher, see Panel.FieldOverrides.
+// Overrides with the same matcher id and options are taken from ps1.
+func WithMergeFieldOverrides() Option {
+	return func(o *options) {
+		o.mergeOverrides = true
+	}
+}
+
+// WithSortAppended makes MergePanels sort the panels appended from ps2 by title,
+// rows are not sorted and the panels are only sorted within their row.
+// MergePanelsByGroup also sorts the panels of the groups that are only in ps2.
+func WithSortAppended() Option {
+	return func(o *options) {
+		o.sortAppended = true
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import "encoding/json"
+
+// FieldOverrides returns the elements of the panel fieldConfig.overrides array and whether it is present.
+func (p Panel) FieldOverrides() ([]json.RawMessage, bool) {
+	var fc map[string]json.RawMessage
+	if err := json.Unmarshal(p["fieldConfig"], &fc); err != nil {
+		return nil, false
+	}
+	return Panel(fc).arrayField("overrides")
+}
+
+// setFieldOverrides sets the fieldConfig.overrides array of the panel,
+// preserving the other fields of fieldConfig.
+func (p Panel) setFieldOverrides(overrides []json.RawMessage) error {
+	fc := objectField(p, "fieldConfig")
+	if err := setField(fc, "overrides", overrides); err != nil {
+		return err
+	}
+	return p.setField("fieldConfig", fc)
+}
+
+// unionOverrides returns the overrides in o1 followed by the overrides in o2
+// whose matcher is not used in o1. Overrides are identified by their matcher id and options.
+func unionOverrides(o1, o2 []json.RawMessage) []json.RawMessage {
+	seen := make(map[string]bool, len(o1)+len(o2))
+	res := make([]json.RawMessage, 0, len(o1)+len(o2))
+	for _, l := range [][]json.RawMessage{o1, o2} {
+		for _, o := range l {
+			var v struct {
+				Matcher json.RawMessage `json:"matcher"`
+			}
+			if err := json.Unmarshal(o, &v); err == nil && v.Matcher != nil {
+				k := string(v.Matcher)
+				if c, err := canonicalize(v.Matcher); err == nil {
+					k = string(c)
+				}
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+			}
+			res = append(res, o)
+		}
+	}
+	return res
+}
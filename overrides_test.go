@@ -0,0 +1,67 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergePanelsFieldOverrides(t *testing.T) {
+	t.Parallel()
+
+	base := []Panel{
+		{
+			"title": json.RawMessage(`"Latency"`),
+			"type":  json.RawMessage(`"timeseries"`),
+			"fieldConfig": json.RawMessage(`{"defaults":{"unit":"ms"},"overrides":[
+				{"matcher":{"id":"byName","options":"p99"},"properties":[{"id":"color","value":"red"}]},
+				{"matcher":{"id":"byName","options":"p50"},"properties":[{"id":"unit","value":"s"}]}
+			]}`),
+		},
+	}
+	extra := []Panel{
+		{
+			"title": json.RawMessage(`"Latency"`),
+			"type":  json.RawMessage(`"timeseries"`),
+			"fieldConfig": json.RawMessage(`{"defaults":{"unit":"s"},"overrides":[
+				{"matcher":{"options":"p99","id":"byName"},"properties":[{"id":"color","value":"blue"}]},
+				{"matcher":{"id":"byRegexp","options":"p.*"},"properties":[]}
+			]}`),
+		},
+	}
+
+	merged := MergePanels(base, extra, WithMergeFieldOverrides())
+	overrides, ok := merged[0].FieldOverrides()
+	if !ok {
+		t.Fatal("expected field overrides")
+	}
+	var got []string
+	for _, o := range overrides {
+		c, err := canonicalize(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(c))
+	}
+	want := []string{
+		`{"matcher":{"id":"byName","options":"p99"},"properties":[{"id":"color","value":"red"}]}`,
+		`{"matcher":{"id":"byName","options":"p50"},"properties":[{"id":"unit","value":"s"}]}`,
+		`{"matcher":{"id":"byRegexp","options":"p.*"},"properties":[]}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	var fc struct {
+		Defaults map[string]string `json:"defaults"`
+	}
+	if err := json.Unmarshal(merged[0]["fieldConfig"], &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Defaults["unit"] != "s" {
+		t.Fatalf("expected field defaults to be taken from ps2, got %v", fc.Defaults)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+)
+
+// FilterPanels returns the panels for which keep returns true.
+// The panels embedded in the kept rows are filtered too, removing a row removes its embedded panels.
+// The input panels are not modified.
+func FilterPanels(ps []Panel, keep func(Panel) bool) []Panel {
+	res := make([]Panel, 0, len(ps))
+	for _, p := range ps {
+		if !keep(p) {
+			continue
+		}
+		if raw := p.PanelsRaw(); raw != nil {
+			var nested []Panel
+			if err := json.Unmarshal(raw, &nested); err == nil {
+				p = p.Clone()
+				if err := p.setField("panels", FilterPanels(nested, keep)); err != nil {
+					panic(err)
+				}
+			}
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// RemovePanels returns the panels for which remove returns false, see FilterPanels.
+// The input panels are not modified.
+func RemovePanels(ps []Panel, remove func(Panel) bool) []Panel {
+	return FilterPanels(ps, func(p Panel) bool {
+		return !remove(p)
+	})
+}
+
+// DedupePanels removes the panels that match an earlier panel, keeping the first occurrence.
+//
+// By default panels match when they have the same content, ignoring gridPos and id,
+// see WithIgnoreDatasourceFormat and WithNormalizeMappings.
+// Use WithMatcher to dedupe by other criteria, e.g. WithMatcher(Panel.Equals).
+// The input slice is not modified.
+func DedupePanels(ps []Panel, opts ...Option) []Panel {
+	byContent := func(o *options) {
+		o.match = nil
+		o.matchKey = nil
+	}
+	o := newOptions(append([]Option{byContent}, opts...))
+
+	res := make([]Panel, 0, len(ps))
+	switch {
+	case o.match == nil:
+		// every panel is hashed once, panels with the same hash are compared since
+		// the hash does not tell apart panels that differ only by their datasources
+		seen := make(map[string][]Panel, len(ps))
+		for _, p := range ps {
+			k := p.ContentHash(opts...)
+			if slices.ContainsFunc(seen[k], func(q Panel) bool { return o.sameContent(q, p) }) {
+				continue
+			}
+			seen[k] = append(seen[k], p)
+			res = append(res, p)
+		}
+	case o.matchKey != nil:
+		seen := make(map[string]bool, len(ps))
+		for _, p := range ps {
+			k, ok := o.matchKey(p)
+			if ok && seen[k] {
+				continue
+			}
+			if ok {
+				seen[k] = true
+			}
+			res = append(res, p)
+		}
+	default:
+		for _, p := range ps {
+			if !slices.ContainsFunc(res, func(q Panel) bool { return o.match(q, p) }) {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
+
+// SortPanelsByPosition is like SortPanelsByPositionE but panics on error.
+func SortPanelsByPosition(ps []Panel) []Panel {
+	res, err := SortPanelsByPositionE(ps)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// SortPanelsByPositionE returns the panels sorted in reading order,
+// top to bottom by gridPos Y and then left to right by gridPos X.
+// Rows sort before the other panels at the same Y.
+// The input slice is not modified.
+// It returns a *MergeError if the gridPos of a panel cannot be unmarshalled.
+func SortPanelsByPositionE(ps []Panel) ([]Panel, error) {
+	type positioned struct {
+		p   Panel
+		gp  GridPos
+		row bool
+	}
+	sorted := make([]positioned, len(ps))
+	for i, p := range ps {
+		gp, err := p.GridPosE()
+		if err != nil {
+			return nil, err
+		}
+		sorted[i] = positioned{p: p, gp: gp, row: p.isRow()}
+	}
+
+	slices.SortStableFunc(sorted, func(a, b positioned) int {
+		if c := cmp.Compare(a.gp.Y, b.gp.Y); c != 0 {
+			return c
+		}
+		if a.row != b.row {
+			if a.row {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.gp.X, b.gp.X)
+	})
+
+	res := make([]Panel, len(sorted))
+	for i := range sorted {
+		res[i] = sorted[i].p
+	}
+	return res, nil
+}
+
+// sortPanelsByTitle sorts the panels in place by title, keeping the order of panels with the same title.
+func sortPanelsByTitle(ps []Panel) {
+	slices.SortStableFunc(ps, func(a, b Panel) int {
+		ta, _ := a.Title()
+		tb, _ := b.Title()
+		return cmp.Compare(ta, tb)
+	})
+}
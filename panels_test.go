@@ -0,0 +1,115 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterPanels(t *testing.T) {
+	t.Parallel()
+
+	ps := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Notes","type":"text"},
+			{"title":"CPU","type":"graph"},
+			{"title":"A","type":"row","collapsed":true,"panels":[{"title":"A notes","type":"text"},{"title":"A1","type":"graph"}]},
+			{"title":"Text row","type":"text","collapsed":true,"panels":[{"title":"B1","type":"graph"}]}
+		]`),
+	}.Panels()
+	before, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isText := func(p Panel) bool {
+		t, _ := p.Type()
+		return t == "text"
+	}
+	titles := func(ps []Panel) []string {
+		var res []string
+		for _, p := range liftEmbeddedPanels(ps) {
+			title, _ := p.Title()
+			res = append(res, title)
+		}
+		return res
+	}
+
+	if diff := cmp.Diff([]string{"CPU", "A", "A1"}, titles(RemovePanels(ps, isText))); diff != "" {
+		t.Errorf("unexpected removed panels (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Notes", "Text row"}, titles(FilterPanels(ps, isText))); diff != "" {
+		t.Errorf("unexpected filtered panels (-want +got):\n%s", diff)
+	}
+
+	after, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Error("the input panels were modified")
+	}
+}
+
+func TestDedupePanels(t *testing.T) {
+	t.Parallel()
+
+	ps := []Panel{
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{"a":1}`), "id": json.RawMessage(`1`)},
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{"a":2}`), "id": json.RawMessage(`2`)},
+		{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`), "options": json.RawMessage(`{ "a": 1 }`), "id": json.RawMessage(`3`)},
+	}
+
+	if diff := cmp.Diff([]Panel{ps[0], ps[1]}, DedupePanels(ps)); diff != "" {
+		t.Errorf("unexpected result by content (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Panel{ps[0]}, DedupePanels(ps, WithMatcher(Panel.Equals))); diff != "" {
+		t.Errorf("unexpected result by title and type (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(ps, DedupePanels(ps, WithMatchByID())); diff != "" {
+		t.Errorf("unexpected result by id (-want +got):\n%s", diff)
+	}
+}
+
+func TestSortPanelsByPosition(t *testing.T) {
+	t.Parallel()
+
+	panel := func(title, typ, gridPos string) Panel {
+		return Panel{
+			"title":   json.RawMessage(`"` + title + `"`),
+			"type":    json.RawMessage(`"` + typ + `"`),
+			"gridPos": json.RawMessage(gridPos),
+		}
+	}
+	ps := []Panel{
+		panel("B2", "graph", `{"h":2,"w":6,"x":6,"y":5}`),
+		panel("A2", "graph", `{"h":2,"w":6,"x":12,"y":0}`),
+		panel("B1", "graph", `{"h":2,"w":6,"x":0,"y":5}`),
+		panel("Row B", "row", `{"h":1,"w":24,"x":0,"y":5}`),
+		panel("A1", "graph", `{"h":2,"w":6,"x":0,"y":0}`),
+		panel("A3", "graph", `{"h":2,"w":6,"x":0,"y":2}`),
+	}
+	before := clonePanels(ps)
+
+	var got []string
+	for _, p := range SortPanelsByPosition(ps) {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"A1", "A2", "A3", "Row B", "B1", "B2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(before, ps); diff != "" {
+		t.Fatalf("input modified (-want +got):\n%s", diff)
+	}
+
+	var me *MergeError
+	if _, err := SortPanelsByPositionE([]Panel{{"type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`"oops"`)}}); !errors.As(err, &me) {
+		t.Fatalf("expected a *MergeError, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+// MergeAction is the action applied to a panel by MergePanels.
+type MergeAction string
+
+const (
+	// ActionKeep keeps a panel of ps1 that no panel of ps2 matched.
+	ActionKeep MergeAction = "keep"
+	// ActionUpdate overwrites a panel of ps1 with a matching panel of ps2.
+	ActionUpdate MergeAction = "update"
+	// ActionAppend appends a panel of ps2 that did not match any panel of ps1.
+	ActionAppend MergeAction = "append"
+)
+
+// MergePlan describes the result of merging two sets of panels, see PreviewMerge.
+type MergePlan struct {
+	// Steps are the panels of the merge result in order.
+	Steps []MergeStep `json:"steps"`
+}
+
+// MergeStep describes a single panel of the merge result.
+type MergeStep struct {
+	Action MergeAction `json:"action"`
+	Title  string      `json:"title,omitempty"`
+	Type   string      `json:"type,omitempty"`
+	// ID is the id of the resulting panel, 0 if it has none.
+	ID int `json:"id,omitempty"`
+	// GridPos is the position of the resulting panel.
+	GridPos GridPos `json:"gridPos"`
+}
+
+// PreviewMerge returns the plan of MergePanels(ps1, ps2, opts...), that is the action
+// applied to each resulting panel and its position, so that it can be reviewed before merging.
+// The input panels are not modified.
+// It returns a *MergeError if a field of a panel cannot be marshalled or unmarshalled.
+func PreviewMerge(ps1, ps2 []Panel, opts ...Option) (MergePlan, error) {
+	res, err := mergePanels(ps1, ps2, newOptions(opts))
+	if err != nil {
+		return MergePlan{}, err
+	}
+
+	actions := make([]MergeAction, len(res.Panels))
+	for i := range actions {
+		actions[i] = ActionKeep
+	}
+	for _, i := range res.Updated {
+		actions[i] = ActionUpdate
+	}
+	for _, i := range res.Appended {
+		actions[i] = ActionAppend
+	}
+
+	plan := MergePlan{
+		Steps: make([]MergeStep, 0, len(res.Panels)),
+	}
+	for i, p := range res.Panels {
+		gp, err := p.GridPosE()
+		if err != nil {
+			return MergePlan{}, err
+		}
+		s := MergeStep{
+			Action:  actions[i],
+			GridPos: gp,
+		}
+		s.Title, _ = p.Title()
+		s.Type, _ = p.Type()
+		s.ID, _ = p.ID()
+		plan.Steps = append(plan.Steps, s)
+	}
+	return plan, nil
+}
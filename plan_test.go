@@ -0,0 +1,55 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreviewMerge(t *testing.T) {
+	t.Parallel()
+
+	ps1 := []Panel{
+		{"title": json.RawMessage(`"Kept"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`1`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"Updated"`), "type": json.RawMessage(`"graph"`), "id": json.RawMessage(`2`), "gridPos": json.RawMessage(`{"h":2,"w":6,"x":6,"y":0}`)},
+	}
+	ps2 := []Panel{
+		{"title": json.RawMessage(`"Updated"`), "type": json.RawMessage(`"graph"`), "gridPos": json.RawMessage(`{"h":4,"w":12,"x":0,"y":0}`)},
+		{"title": json.RawMessage(`"New"`), "type": json.RawMessage(`"stat"`), "gridPos": json.RawMessage(`{"h":3,"w":4,"x":0,"y":0}`)},
+	}
+	before, _ := json.Marshal([]any{ps1, ps2})
+
+	plan, err := PreviewMerge(ps1, ps2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MergePlan{
+		Steps: []MergeStep{
+			{Action: ActionKeep, Title: "Kept", Type: "graph", ID: 1, GridPos: GridPos{H: 2, W: 6, X: 0, Y: 0}},
+			{Action: ActionUpdate, Title: "Updated", Type: "graph", ID: 2, GridPos: GridPos{H: 2, W: 6, X: 6, Y: 0}},
+			{Action: ActionAppend, Title: "New", Type: "stat", ID: 3, GridPos: GridPos{H: 3, W: 4, X: 0, Y: 3}},
+		},
+	}
+	if diff := cmp.Diff(want, plan); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	if after, _ := json.Marshal([]any{ps1, ps2}); string(after) != string(before) {
+		t.Fatal("the input panels were modified")
+	}
+
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got MergePlan
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(plan, got); diff != "" {
+		t.Fatalf("unexpected round trip (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Thresholds returns the raw fieldConfig.defaults.thresholds of the panel and whether it is present.
+func (p Panel) Thresholds() (json.RawMessage, bool) {
+	var fc, defaults map[string]json.RawMessage
+	if err := json.Unmarshal(p["fieldConfig"], &fc); err != nil {
+		return nil, false
+	}
+	if err := json.Unmarshal(fc["defaults"], &defaults); err != nil {
+		return nil, false
+	}
+	raw, ok := defaults["thresholds"]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		return nil, false
+	}
+	return raw, true
+}
+
+// SetThresholds sets the fieldConfig.defaults.thresholds of the panel, creating fieldConfig
+// and defaults if absent and preserving their other fields.
+func (p Panel) SetThresholds(thresholds json.RawMessage) error {
+	fc := objectField(p, "fieldConfig")
+	defaults := objectField(fc, "defaults")
+	if err := setField(defaults, "thresholds", thresholds); err != nil {
+		return err
+	}
+	if err := setField(fc, "defaults", defaults); err != nil {
+		return err
+	}
+	return p.setField("fieldConfig", fc)
+}
+
+// objectField returns the object in m[key], or an empty object if it is absent or not an object.
+func objectField(m map[string]json.RawMessage, key string) map[string]json.RawMessage {
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(m[key], &v); err != nil || v == nil {
+		return make(map[string]json.RawMessage)
+	}
+	return v
+}
+
+// SetThresholdsForType returns a copy of the dashboard where the thresholds of every panel
+// of the given type, including panels nested in rows, are set to thresholds, see Panel.SetThresholds.
+func SetThresholdsForType(d Dashboard, panelType string, thresholds json.RawMessage) (Dashboard, error) {
+	return d.TransformPanels(func(p Panel) (Panel, error) {
+		if t, ok := p.Type(); !ok || t != panelType {
+			return p, nil
+		}
+		if err := p.SetThresholds(thresholds); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+}
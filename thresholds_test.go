@@ -0,0 +1,93 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestThresholds(t *testing.T) {
+	t.Parallel()
+
+	const thresholds = `{"mode":"absolute","steps":[{"color":"green","value":null},{"color":"red","value":500}]}`
+
+	tests := []struct {
+		name        string
+		fieldConfig string
+		want        string
+	}{
+		{
+			name: "no fieldConfig",
+			want: `{"defaults":{"thresholds":` + thresholds + `}}`,
+		},
+		{
+			name:        "no defaults",
+			fieldConfig: `{"overrides":[]}`,
+			want:        `{"defaults":{"thresholds":` + thresholds + `},"overrides":[]}`,
+		},
+		{
+			name:        "existing thresholds",
+			fieldConfig: `{"defaults":{"unit":"ms","thresholds":{"mode":"percentage"}}}`,
+			want:        `{"defaults":{"thresholds":` + thresholds + `,"unit":"ms"}}`,
+		},
+	}
+
+	for i := range tests {
+		tc := tests[i]
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := Panel{"title": json.RawMessage(`"Latency"`)}
+			if tc.fieldConfig != "" {
+				p["fieldConfig"] = json.RawMessage(tc.fieldConfig)
+			}
+			if err := p.SetThresholds(json.RawMessage(thresholds)); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, string(p["fieldConfig"])); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+
+			got, ok := p.Thresholds()
+			if !ok {
+				t.Fatal("expected thresholds")
+			}
+			if diff := cmp.Diff(thresholds, string(got)); diff != "" {
+				t.Fatalf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, ok := (Panel{"fieldConfig": json.RawMessage(`{"defaults":{"thresholds":null}}`)}).Thresholds(); ok {
+		t.Fatal("expected no thresholds")
+	}
+}
+
+func TestSetThresholdsForType(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Latency","type":"timeseries"},
+			{"title":"Stat","type":"stat"},
+			{"title":"B","type":"row","collapsed":true,"panels":[{"title":"Errors","type":"timeseries","fieldConfig":{"defaults":{"unit":"short"}}}]}
+		]`),
+	}
+
+	got, err := SetThresholdsForType(d, "timeseries", json.RawMessage(`{"mode":"absolute"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"fieldConfig":{"defaults":{"thresholds":{"mode":"absolute"}}},"title":"Latency","type":"timeseries"},` +
+		`{"title":"Stat","type":"stat"},` +
+		`{"collapsed":true,"panels":[{"fieldConfig":{"defaults":{"thresholds":{"mode":"absolute"},"unit":"short"}},"title":"Errors","type":"timeseries"}],"title":"B","type":"row"}]`
+	if diff := cmp.Diff(want, string(got["panels"])); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+	if _, ok := d.Panels()[0].Thresholds(); ok {
+		t.Fatal("expected input dashboard to be unchanged")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import "encoding/json"
+
+// DashboardStruct is a typed view of the most common fields of a dashboard.
+// The other fields are kept in Extra, so that converting a dashboard to
+// a DashboardStruct and back does not lose any field.
+type DashboardStruct struct {
+	Title  string
+	UID    string
+	Tags   []string
+	Panels []Panel
+	// Templating is the list of template variables.
+	Templating []json.RawMessage
+	// Time is the default time range, it is nil if the dashboard has none.
+	Time *TimeRange
+
+	// Extra holds the top-level fields that are not modeled above,
+	// as well as the modeled fields that are present but empty.
+	Extra Dashboard
+}
+
+// FromDashboard returns the typed view of the dashboard.
+// The dashboard is not modified.
+func FromDashboard(d Dashboard) (DashboardStruct, error) {
+	s := DashboardStruct{
+		Extra: d.Clone(),
+	}
+	if s.Extra == nil {
+		s.Extra = make(Dashboard)
+	}
+
+	// modeled fields are removed from Extra only if they are not empty,
+	// so that empty fields are preserved as they are
+	if title, ok := d.Title(); ok && title != "" {
+		s.Title = title
+		delete(s.Extra, "title")
+	}
+	if uid, ok := d.UID(); ok && uid != "" {
+		s.UID = uid
+		delete(s.Extra, "uid")
+	}
+
+	tags, err := d.Tags()
+	if err != nil {
+		return DashboardStruct{}, err
+	}
+	if len(tags) > 0 {
+		s.Tags = tags
+		delete(s.Extra, "tags")
+	}
+
+	ps, err := d.PanelsE()
+	if err != nil {
+		return DashboardStruct{}, err
+	}
+	if len(ps) > 0 {
+		s.Panels = ps
+		delete(s.Extra, "panels")
+	}
+
+	// the templating object is kept in Extra since it may have other fields than the list
+	if s.Templating, err = d.list("templating"); err != nil {
+		return DashboardStruct{}, err
+	}
+
+	if tr, ok := d.Time(); ok && tr != (TimeRange{}) {
+		s.Time = &tr
+		delete(s.Extra, "time")
+	}
+
+	return s, nil
+}
+
+// ToDashboard returns the dashboard with the fields of s.
+// Empty modeled fields are not set, the fields in Extra are copied as they are.
+func (s DashboardStruct) ToDashboard() (Dashboard, error) {
+	d := s.Extra.Clone()
+	if d == nil {
+		d = make(Dashboard)
+	}
+
+	fields := []struct {
+		key   string
+		value any
+		set   bool
+	}{
+		{"title", s.Title, s.Title != ""},
+		{"uid", s.UID, s.UID != ""},
+		{"tags", s.Tags, len(s.Tags) > 0},
+		{"panels", s.Panels, len(s.Panels) > 0},
+		{"time", s.Time, s.Time != nil},
+	}
+	for _, f := range fields {
+		if !f.set {
+			continue
+		}
+		if err := setField(d, f.key, f.value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.setList("templating", s.Templating); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDashboardStruct(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"title":        json.RawMessage(`"Service"`),
+		"uid":          json.RawMessage(`""`),
+		"tags":         json.RawMessage(`["a","b"]`),
+		"panels":       json.RawMessage(`[{"title":"Panel1","type":"graph"}]`),
+		"templating":   json.RawMessage(`{"list":[{"name":"env"}]}`),
+		"time":         json.RawMessage(`{"from":"now-6h","to":"now"}`),
+		"graphTooltip": json.RawMessage(`1`),
+	}
+
+	s, err := FromDashboard(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DashboardStruct{
+		Title:      "Service",
+		Tags:       []string{"a", "b"},
+		Panels:     []Panel{{"title": json.RawMessage(`"Panel1"`), "type": json.RawMessage(`"graph"`)}},
+		Templating: []json.RawMessage{json.RawMessage(`{"name":"env"}`)},
+		Time:       &TimeRange{From: "now-6h", To: "now"},
+		Extra: Dashboard{
+			"uid":          json.RawMessage(`""`),
+			"templating":   json.RawMessage(`{"list":[{"name":"env"}]}`),
+			"graphTooltip": json.RawMessage(`1`),
+		},
+	}
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	back, err := s.ToDashboard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range d {
+		if !rawEqual(v, back[k]) {
+			t.Errorf("%s: expected %s, got %s", k, v, back[k])
+		}
+	}
+	if len(back) != len(d) {
+		t.Errorf("expected %d fields, got %d", len(d), len(back))
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DuplicateIDs returns the sorted list of panel ids that are used by more than one panel,
+// including panels nested in rows. Panels without an id are ignored.
+func (d Dashboard) DuplicateIDs() ([]int, error) {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return nil, err
+	}
+	all, err := flattenPanels(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	count := make(map[int]int)
+	for _, p := range all {
+		if id, ok := p.ID(); ok {
+			count[id]++
+		}
+	}
+
+	var dups []int
+	for id, n := range count {
+		if n > 1 {
+			dups = append(dups, id)
+		}
+	}
+	slices.Sort(dups)
+
+	return dups, nil
+}
+
+// variableRef matches the template variable references $var, ${var}, ${var:format} and [[var]].
+var variableRef = regexp.MustCompile(`\$\{(\w+)(?:[:.][^}]*)?\}|\$(\w+)|\[\[(\w+)(?::\w+)?\]\]`)
+
+// UndefinedVariableRefs returns the sorted names of the template variables referenced by the panels,
+// including panels nested in rows, that are not defined in templating.
+// The references are looked up in the panels JSON text. Grafana global variables like
+// $__interval and $timeFilter and numeric references like $1 are ignored.
+func (d Dashboard) UndefinedVariableRefs() ([]string, error) {
+	list, err := d.list("templating")
+	if err != nil {
+		return nil, err
+	}
+	defined := make(map[string]bool, len(list))
+	for _, v := range list {
+		if name, ok := listEntryName(v); ok {
+			defined[name] = true
+		}
+	}
+
+	if err := checkPanelsField(d["panels"]); err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, m := range variableRef.FindAllSubmatch(d["panels"], -1) {
+		// only one of the alternatives matched
+		name := string(m[1]) + string(m[2]) + string(m[3])
+		if defined[name] || strings.HasPrefix(name, "__") || name == "timeFilter" || name[0] >= '0' && name[0] <= '9' {
+			continue
+		}
+		if !slices.Contains(res, name) {
+			res = append(res, name)
+		}
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+// queryLessPanelTypes are the panel types that have no queries by design.
+var queryLessPanelTypes = map[string]bool{
+	"text":     true,
+	"row":      true,
+	"dashlist": true,
+}
+
+// EmptyPanels is like EmptyPanelsE but panics on error.
+func (d Dashboard) EmptyPanels() []Panel {
+	ps, err := d.EmptyPanelsE()
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// EmptyPanelsE returns the panels, including panels nested in rows, that have no targets
+// or an empty targets array, and would therefore render blank.
+// Panel types without queries, i.e. text, row and dashlist, and library panels,
+// whose targets are stored outside the dashboard, are ignored.
+func (d Dashboard) EmptyPanelsE() ([]Panel, error) {
+	all, err := d.AllPanelsE()
+	if err != nil {
+		return nil, err
+	}
+	var res []Panel
+	for _, p := range all {
+		if t, _ := p.Type(); queryLessPanelTypes[t] {
+			continue
+		}
+		if _, ok := p.LibraryPanel(); ok {
+			continue
+		}
+		if targets, _ := p.Targets(); len(targets) == 0 {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// Validate checks the structural invariants of the dashboard and returns all the problems found:
+// panels must be an array, every panel must have a type and a grid position with
+// non-negative coordinates and a width between 1 and the grid width, 24 by default, see WithGridWidth,
+// and panels must not overlap.
+// Panels nested in rows are checked too, overlaps are only checked between top-level panels.
+func (d Dashboard) Validate(opts ...Option) []error {
+	ps, err := d.PanelsE()
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := validatePanels(ps, "", newOptions(opts).gridWidth)
+	// a malformed gridPos is already reported above, overlaps cannot be checked without it
+	overlaps, err := OverlappingPanelsE(ps, opts...)
+	if err != nil {
+		return errs
+	}
+	for _, o := range overlaps {
+		errs = append(errs, fmt.Errorf("panel %d %s overlaps panel %d %s", o[0], panelKey(ps[o[0]]), o[1], panelKey(ps[o[1]])))
+	}
+	return errs
+}
+
+func validatePanels(ps []Panel, prefix string, width int) []error {
+	var errs []error
+	for i, p := range ps {
+		name := fmt.Sprintf("panel %s%d", prefix, i)
+		if title, ok := p.Title(); ok {
+			name = fmt.Sprintf("%s %q", name, title)
+		}
+
+		if _, ok := p.Type(); !ok {
+			errs = append(errs, fmt.Errorf("%s: missing type", name))
+		}
+
+		if gp, err := p.GridPosE(); err != nil {
+			var me *MergeError
+			if errors.As(err, &me) {
+				err = me.Err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		} else if p.GridPosRaw() == nil {
+			errs = append(errs, fmt.Errorf("%s: missing gridPos", name))
+		} else {
+			if gp.X < 0 || gp.Y < 0 || gp.H < 0 {
+				errs = append(errs, fmt.Errorf("%s: negative gridPos %+v", name, gp))
+			}
+			if gp.W < 1 || gp.W > width {
+				errs = append(errs, fmt.Errorf("%s: gridPos width %d out of range 1..%d", name, gp.W, width))
+			}
+		}
+
+		if raw := p.PanelsRaw(); raw != nil {
+			var nested []Panel
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				errs = append(errs, fmt.Errorf("%s: unmarshal panels: %w", name, err))
+				continue
+			}
+			if prefix != "" && p.isRow() && len(nested) > 0 {
+				errs = append(errs, fmt.Errorf("%s: row nested in a row", name))
+			}
+			errs = append(errs, validatePanels(nested, fmt.Sprintf("%s%d.", prefix, i), width)...)
+		}
+	}
+	return errs
+}
+
+// flattenPanels returns the panels followed, recursively, by the panels embedded in them.
+func flattenPanels(ps []Panel) ([]Panel, error) {
+	res := make([]Panel, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, p)
+
+		raw := p.PanelsRaw()
+		if raw == nil {
+			continue
+		}
+		var nested []Panel
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			return nil, newMergeError(p, "panels", fmt.Errorf("unmarshal panels: %w", err))
+		}
+		nested, err := flattenPanels(nested)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, nested...)
+	}
+	return res, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Sauce Labs Inc., all rights reserved.
+
+package dashboardfusion
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDuplicateIDs(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"id":1,"type":"graph"},
+			{"type":"graph"},
+			{"type":"graph"},
+			{"id":2,"type":"row","collapsed":true,"panels":[{"id":1,"type":"graph"},{"id":3,"type":"graph"}]},
+			{"id":3,"type":"graph"}
+		]`),
+	}
+
+	dups, err := d.DuplicateIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 3}, dups); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Ok","type":"graph","gridPos":{"h":2,"w":6,"x":0,"y":0}},
+			{"title":"Overlap","type":"graph","gridPos":{"h":2,"w":6,"x":3,"y":1}},
+			{"title":"NoType","gridPos":{"h":2,"w":6,"x":0,"y":10}},
+			{"title":"Row","type":"row","collapsed":true,"gridPos":{"h":1,"w":24,"x":0,"y":20},"panels":[
+				{"title":"Wide","type":"graph","gridPos":{"h":2,"w":30,"x":-1,"y":21}}
+			]}
+		]`),
+	}
+
+	var got []string
+	for _, err := range d.Validate() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`panel 2 "NoType": missing type`,
+		`panel 3.0 "Wide": negative gridPos {H:2 W:30 X:-1 Y:21}`,
+		`panel 3.0 "Wide": gridPos width 30 out of range 1..24`,
+		`panel 0 graph "Ok" overlaps panel 1 graph "Overlap"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected errors (-want +got):\n%s", diff)
+	}
+
+	if errs := (Dashboard{"panels": json.RawMessage(`{}`)}).Validate(); len(errs) != 1 {
+		t.Fatalf("expected an error for non-array panels, got %v", errs)
+	}
+
+	d = Dashboard{"panels": json.RawMessage(`[{"title":"Bad","type":"graph","gridPos":"oops"}]`)}
+	if errs := d.Validate(); len(errs) != 1 || !strings.Contains(errs[0].Error(), `panel 0 "Bad": unmarshal gridPos`) {
+		t.Fatalf("expected an error for the malformed gridPos, got %v", errs)
+	}
+}
+
+func TestUndefinedVariableRefs(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"templating": json.RawMessage(`{"list":[{"name":"env"},{"name":"datasource"}]}`),
+		"panels": json.RawMessage(`[
+			{"title":"CPU $env","datasource":"${datasource}","targets":[{"expr":"rate(cpu{env=\"$env\",pod=~\"${pod:regex}\"}[$__rate_interval])"}]},
+			{"title":"Row","type":"row","collapsed":true,"panels":[{"title":"[[host]]","targets":[{"query":"SELECT * WHERE $timeFilter"}]}]},
+			{"title":"Rename","transformations":[{"options":{"regex":"(.*)","renamePattern":"$1 $cluster"}}]}
+		]`),
+	}
+
+	got, err := d.UndefinedVariableRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cluster", "host", "pod"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestEmptyPanels(t *testing.T) {
+	t.Parallel()
+
+	d := Dashboard{
+		"panels": json.RawMessage(`[
+			{"title":"Ok","type":"graph","targets":[{"expr":"up"}]},
+			{"title":"NoTargets","type":"graph"},
+			{"title":"Notes","type":"text"},
+			{"title":"Links","type":"dashlist"},
+			{"title":"Shared","type":"graph","libraryPanel":{"uid":"abc","name":"Shared"}},
+			{"title":"Row","type":"row","collapsed":true,"panels":[
+				{"title":"EmptyTargets","type":"stat","targets":[]},
+				{"title":"NullTargets","type":"stat","targets":null}
+			]}
+		]`),
+	}
+
+	var got []string
+	for _, p := range d.EmptyPanels() {
+		title, _ := p.Title()
+		got = append(got, title)
+	}
+	want := []string{"NoTargets", "EmptyTargets", "NullTargets"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected result (-want +got):\n%s", diff)
+	}
+
+	if _, err := (Dashboard{"panels": json.RawMessage(`{}`)}).EmptyPanelsE(); err == nil || !strings.Contains(err.Error(), "panels field is not an array") {
+		t.Fatalf("expected not an array error, got %v", err)
+	}
+}